@@ -5,11 +5,16 @@ import (
 	"fmt"
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/common/errors"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/network"
 	"github.com/cloudwego/hertz/pkg/protocol"
 	"github.com/cloudwego/hertz/pkg/protocol/consts"
 	"github.com/mattn/go-isatty"
 	"io"
 	"os"
+	"runtime"
+	"sort"
+	"strings"
 	"time"
 )
 
@@ -40,13 +45,76 @@ type LoggerConfig struct {
 	// Optional. Default value is defaultLogFormatter
 	Formatter LogFormatter
 
-	// Output is a writer where logs are written.
+	// Output is a writer where logs are written. Its errors are reported to
+	// ErrorHandler; wrap it with NewBreakerWriter to stop writing to it while
+	// it fails.
 	// Optional. Default value is os.Stdout.
 	Output io.Writer
 
+	// ErrorHandler is called with the write errors of Output, and of the
+	// Outputs without an ErrorHandler of their own.
+	// Optional. Default value is nil, errors are dropped.
+	ErrorHandler func(err error)
+
 	// SkipPaths is an url path array which logs are not written.
 	// Optional.
 	SkipPaths []string
+
+	// Sink receives every access event instead of Formatter and Output.
+	// Optional. Default value writes Formatter's result to Output.
+	Sink Sink
+
+	// Outputs receive every access event instead of Formatter and Output,
+	// each one formatting and selecting events on its own. Ignored when Sink
+	// is set.
+	// Optional.
+	Outputs []Output
+
+	// Recover catches panics raised by the following handlers, so the request
+	// is still logged, at error level and with the panic value and stack.
+	// Optional. Default value is false.
+	Recover bool
+
+	// RecoverHandler is called once a caught panic has been logged.
+	// Optional. Default value re-panics with the recovered value.
+	RecoverHandler RecoverHandler
+
+	// Tracer holds back access events until the response has been written, to
+	// add the latency of each server phase. It must be registered with server.WithTracer too.
+	// Optional.
+	Tracer *Tracer
+
+	// SlowThresholds are the elapsed times at which a request still in flight
+	// is reported with an InFlight event. Requests slower than the first one
+	// are flagged Slow once completed.
+	// Optional. Default value is nil, requests are not watched.
+	SlowThresholds []time.Duration
+
+	// Registry keeps track of the requests in flight.
+	// Optional. Default value is a private Registry when SlowThresholds is set.
+	Registry *Registry
+}
+
+// RecoverHandler gives the signature of the function handling a panic caught by Logger.
+type RecoverHandler func(c context.Context, ctx *app.RequestContext, err any)
+
+// AbortOnPanic is a RecoverHandler that stops the handler chain and responds
+// with the status already set, 500 unless the handler wrote one.
+func AbortOnPanic(_ context.Context, ctx *app.RequestContext, _ any) {
+	ctx.Abort()
+}
+
+// Sink receives the access event of every logged request.
+type Sink interface {
+	Emit(c context.Context, param LogFormatterParams)
+}
+
+// SinkFunc is an adapter to allow the use of ordinary functions as a Sink.
+type SinkFunc func(c context.Context, param LogFormatterParams)
+
+// Emit calls f(c, param).
+func (f SinkFunc) Emit(c context.Context, param LogFormatterParams) {
+	f(c, param)
 }
 
 // LogFormatter gives the signature of the formatter function passed to LoggerWithFormatter
@@ -68,6 +136,9 @@ type LogFormatterParams struct {
 	Method string
 	// Path is a path the client requests.
 	Path string
+	// Route is the route template the request matched, such as /users/:id,
+	// empty when none did.
+	Route string
 	// Host is a Host the client requests.
 	Host string
 	// ErrorMessage is set if error has occurred in processing the request.
@@ -75,9 +146,64 @@ type LogFormatterParams struct {
 	// isTerm shows whether output descriptor refers to a terminal.
 	isTerm bool
 	// BodySize is the size of the Response Body
+	// For streamed bodies it is the number of bytes actually sent.
 	BodySize int
+	// ContentLength is the declared size of the Response Body, -1 for a
+	// stream of unknown length, such as a chunked response.
+	ContentLength int
+	// RequestBodySize is the size of the Request Body, -1 when it is streamed.
+	RequestBodySize int
+	// RequestContentLength is the declared size of the Request Body, -1 when
+	// the request has no Content-Length, such as a chunked request.
+	RequestContentLength int
+	// RequestHeaderSize is the size of the Request Header.
+	RequestHeaderSize int
+	// Proto is the protocol version of the request, such as HTTP/1.1.
+	Proto string
+	// Scheme is the scheme the client used, http or https, after proxy headers.
+	Scheme string
+	// TLSVersion is the TLS version of the connection, empty without TLS.
+	TLSVersion string
+	// TLSCipherSuite is the TLS cipher suite of the connection, empty without TLS.
+	TLSCipherSuite string
+	// RemoteIP is the IP address of the connection's peer.
+	RemoteIP string
+	// RemotePort is the port of the connection's peer.
+	RemotePort int
+	// LocalAddr is the server's address the request was received on.
+	LocalAddr string
 	// Keys are the keys set on the request's context.
 	Keys map[string]any
+	// Panic is the value recovered from a panicking handler, if any.
+	Panic any
+	// Stack is the trimmed stack trace of the recovered panic.
+	Stack string
+	// Hijacked is set on the final event of a hijacked connection, emitted once
+	// the hijack handler returns. Its Latency covers the whole connection.
+	Hijacked bool
+	// ConnBytesRead is the number of bytes read from a hijacked connection.
+	ConnBytesRead int64
+	// ConnBytesWritten is the number of bytes written to a hijacked connection.
+	ConnBytesWritten int64
+	// ReadHeaderLatency is the time spent reading the request header.
+	// Phase latencies are only set when logging through a Tracer.
+	ReadHeaderLatency time.Duration
+	// ReadBodyLatency is the time spent reading the request body.
+	ReadBodyLatency time.Duration
+	// HandleLatency is the time spent in the handlers.
+	HandleLatency time.Duration
+	// WriteLatency is the time spent writing the response.
+	WriteLatency time.Duration
+	// ServerLatency is the total time the server spent on the request.
+	ServerLatency time.Duration
+	// ServerError is the error Hertz reported while reading or writing the
+	// request, such as a malformed header. Only set by a Tracer.
+	ServerError error
+	// InFlight is set on the events reporting a request still running past a
+	// slow threshold. Its Latency is the time elapsed so far and it has no status.
+	InFlight bool
+	// Slow is set on a completed request slower than the first slow threshold.
+	Slow bool
 }
 
 // StatusCodeColor is the ANSI color for appropriately logging http status code to a terminal.
@@ -120,6 +246,18 @@ func (p *LogFormatterParams) MethodColor() string {
 	}
 }
 
+// Level is the log level an access event is reported at, chosen by status code.
+func (p *LogFormatterParams) Level() hlog.Level {
+	switch {
+	case p.Panic != nil, p.StatusCode >= consts.StatusInternalServerError:
+		return hlog.LevelError
+	case p.InFlight, p.StatusCode >= consts.StatusBadRequest:
+		return hlog.LevelWarn
+	default:
+		return hlog.LevelInfo
+	}
+}
+
 // ResetColor resets all escape attributes.
 func (p *LogFormatterParams) ResetColor() string {
 	return reset
@@ -142,15 +280,33 @@ var defaultLogFormatter = func(param LogFormatterParams) string {
 	if param.Latency > time.Minute {
 		param.Latency = param.Latency.Truncate(time.Second)
 	}
-	return fmt.Sprintf("[Hertz] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+	if param.InFlight {
+		if param.IsOutputColor() {
+			statusColor = yellow
+		}
+		return fmt.Sprintf("[Hertz] %v |%s RUN %s| %13v | %15s |%s %-7s %s %#v still running\n",
+			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			statusColor, resetColor,
+			param.Latency,
+			param.ClientIP,
+			methodColor, param.Method, resetColor,
+			param.Path,
+		)
+	}
+	line := fmt.Sprintf("[Hertz] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v%s\n%s",
 		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
 		statusColor, param.StatusCode, resetColor,
 		param.Latency,
 		param.ClientIP,
 		methodColor, param.Method, resetColor,
 		param.Path,
+		protocolDetails(&param),
 		param.ErrorMessage,
 	)
+	if param.Panic != nil {
+		line += fmt.Sprintf("panic: %v\n", param.Panic)
+	}
+	return line
 }
 
 // DisableConsoleColor disables color output in the console.
@@ -187,71 +343,271 @@ func LoggerWithWriter(out io.Writer, notLogged ...string) app.HandlerFunc {
 
 // LoggerWithConfig instance a Logger middleware with config.
 func LoggerWithConfig(conf LoggerConfig) app.HandlerFunc {
-	formatter := conf.Formatter
-	if formatter == nil {
-		formatter = defaultLogFormatter
-	}
+	sink := newSink(conf)
 
-	out := conf.Output
-	if out == nil {
-		out = DefaultWriter
+	emit := sink.Emit
+	if conf.Tracer != nil {
+		emit = func(c context.Context, param LogFormatterParams) {
+			conf.Tracer.emit(c, sink, param)
+		}
 	}
 
-	notLogged := conf.SkipPaths
+	skip := newSkipSet(conf.SkipPaths)
 
-	isTerm := true
+	thresholds := append([]time.Duration(nil), conf.SlowThresholds...)
+	sort.Slice(thresholds, func(i, j int) bool { return thresholds[i] < thresholds[j] })
 
-	if w, ok := out.(*os.File); !ok || os.Getenv("TERM") == "dumb" ||
-		(!isatty.IsTerminal(w.Fd()) && !isatty.IsCygwinTerminal(w.Fd())) {
-		isTerm = false
+	registry := conf.Registry
+	if registry == nil && len(thresholds) > 0 {
+		registry = NewRegistry()
 	}
 
-	var skip map[string]struct{}
+	if len(thresholds) > 0 {
+		emitCompleted := emit
+		emit = func(c context.Context, param LogFormatterParams) {
+			param.Slow = !param.Hijacked && param.Latency >= thresholds[0]
+			emitCompleted(c, param)
+		}
+	}
 
-	if length := len(notLogged); length > 0 {
-		skip = make(map[string]struct{}, length)
+	logRequest := func(c context.Context, ctx *app.RequestContext, start time.Time, path, raw string, recovered any) {
+		// Log only when path is not being skipped
+		if _, ok := skip[path]; ok {
+			return
+		}
 
-		for _, path := range notLogged {
-			skip[path] = struct{}{}
+		param := LogFormatterParams{
+			Request: ctx.Copy().GetRequest(),
+			Keys:    ctx.Keys,
+		}
+
+		// Stop timer
+		param.TimeStamp = time.Now()
+		param.Latency = param.TimeStamp.Sub(start)
+
+		param.ClientIP = ctx.ClientIP()
+		param.Method = string(ctx.Request.Header.Method())
+		param.StatusCode = ctx.Response.StatusCode()
+		param.Host = string(ctx.Request.Host())
+		param.Route = ctx.FullPath()
+		param.ErrorMessage = ctx.Errors.ByType(errors.ErrorTypePrivate).String()
+
+		setConnParams(&param, ctx)
+
+		if recovered != nil {
+			param.Panic = recovered
+			param.Stack = panicStack(4)
+		}
+
+		if raw != "" {
+			path = path + "?" + raw
+		}
+
+		param.Path = path
+
+		if ctx.Response.IsBodyStream() {
+			// The body is only sent after the handlers return, so the event is
+			// emitted once the stream has been drained and closed.
+			param.ContentLength = ctx.Response.Header.ContentLength()
+			if param.ContentLength < 0 {
+				param.ContentLength = -1
+			}
+			stream := &countingBodyStream{r: ctx.Response.BodyStream(), done: func(n int) {
+				param.BodySize = n
+				param.TimeStamp = time.Now()
+				param.Latency = param.TimeStamp.Sub(start)
+				emit(c, param)
+			}}
+			ctx.Response.ConstructBodyStream(ctx.Response.BodyBuffer(), stream)
+			return
+		}
+
+		param.BodySize = len(ctx.Response.Body())
+		param.ContentLength = param.BodySize
+
+		emit(c, param)
+
+		if hijack := ctx.GetHijackHandler(); hijack != nil {
+			ctx.SetHijackHandler(func(conn network.Conn) {
+				if conf.Tracer != nil {
+					// the upgrade response is written, but Hertz finishes the
+					// request only once the connection closes
+					conf.Tracer.release(c, ctx)
+				}
+				cc := &countingConn{Conn: conn}
+				hijack(cc)
+
+				param.Hijacked = true
+				param.ConnBytesRead = cc.read
+				param.ConnBytesWritten = cc.written
+				param.TimeStamp = time.Now()
+				param.Latency = param.TimeStamp.Sub(start)
+				emit(c, param)
+			})
 		}
 	}
 
 	return func(c context.Context, ctx *app.RequestContext) {
+		if conf.Tracer != nil {
+			conf.Tracer.observe(c)
+		}
+
 		// Start timer
 		start := time.Now()
 		path := string(ctx.Request.URI().PathOriginal())
 		raw := string(ctx.Request.URI().QueryString())
 
+		if registry != nil {
+			req := InFlightRequest{
+				ID:       string(ctx.Request.Header.Peek("X-Request-ID")),
+				Method:   string(ctx.Request.Header.Method()),
+				Path:     path,
+				Route:    ctx.FullPath(),
+				Host:     string(ctx.Request.Host()),
+				ClientIP: ctx.ClientIP(),
+				Start:    start,
+			}
+			if req.ID == "" {
+				req.ID = registry.nextID()
+			}
+			if raw != "" {
+				req.Path = path + "?" + raw
+			}
+
+			var onSlow func(InFlightRequest, time.Duration)
+			if _, ok := skip[path]; !ok {
+				onSlow = func(req InFlightRequest, elapsed time.Duration) {
+					sink.Emit(c, LogFormatterParams{
+						TimeStamp: req.Start.Add(elapsed),
+						Latency:   elapsed,
+						ClientIP:  req.ClientIP,
+						Method:    req.Method,
+						Path:      req.Path,
+						Route:     req.Route,
+						Host:      req.Host,
+						InFlight:  true,
+					})
+				}
+			}
+
+			entry := registry.begin(req, thresholds, onSlow)
+			defer registry.end(entry)
+		}
+
+		if conf.Recover {
+			defer func() {
+				if err := recover(); err != nil {
+					if ctx.Response.StatusCode() == consts.StatusOK && !ctx.Response.IsBodyStream() && len(ctx.Response.Body()) == 0 {
+						ctx.SetStatusCode(consts.StatusInternalServerError)
+					}
+
+					logRequest(c, ctx, start, path, raw, err)
+
+					if conf.RecoverHandler == nil {
+						panic(err)
+					}
+					conf.RecoverHandler(c, ctx, err)
+				}
+			}()
+		}
+
 		// Process request
 		ctx.Next(c)
 
-		// Log only when path is not being skipped
-		if _, ok := skip[path]; !ok {
-			param := LogFormatterParams{
-				Request: ctx.Copy().GetRequest(),
-				isTerm:  isTerm,
-				Keys:    ctx.Keys,
+		logRequest(c, ctx, start, path, raw, nil)
+	}
+}
+
+// newSink returns the Sink access events are emitted to according to conf.
+func newSink(conf LoggerConfig) Sink {
+	if conf.Sink != nil {
+		return conf.Sink
+	}
+	if len(conf.Outputs) > 0 {
+		outputs := conf.Outputs
+		if conf.ErrorHandler != nil {
+			outputs = make([]Output, len(conf.Outputs))
+			for i, o := range conf.Outputs {
+				if o.ErrorHandler == nil {
+					o.ErrorHandler = conf.ErrorHandler
+				}
+				outputs[i] = o
 			}
+		}
+		return NewMultiSink(outputs...)
+	}
 
-			// Stop timer
-			param.TimeStamp = time.Now()
-			param.Latency = param.TimeStamp.Sub(start)
+	formatter := conf.Formatter
+	if formatter == nil {
+		formatter = defaultLogFormatter
+	}
 
-			param.ClientIP = ctx.ClientIP()
-			param.Method = string(ctx.Request.Header.Method())
-			param.StatusCode = ctx.Response.StatusCode()
-			param.Host = string(ctx.Request.Host())
-			param.ErrorMessage = ctx.Errors.ByType(errors.ErrorTypePrivate).String()
+	out := conf.Output
+	if out == nil {
+		out = DefaultWriter
+	}
 
-			param.BodySize = len(ctx.Response.Body())
+	return &writerSink{formatter: formatter, out: out, isTerm: isTerminal(out), onError: conf.ErrorHandler}
+}
 
-			if raw != "" {
-				path = path + "?" + raw
-			}
+// newSkipSet returns the set of paths which logs are not written.
+func newSkipSet(notLogged []string) map[string]struct{} {
+	var skip map[string]struct{}
 
-			param.Path = path
+	if length := len(notLogged); length > 0 {
+		skip = make(map[string]struct{}, length)
 
-			_, _ = fmt.Fprint(out, formatter(param))
+		for _, path := range notLogged {
+			skip[path] = struct{}{}
 		}
 	}
+
+	return skip
+}
+
+// writerSink writes the formatted access event to an io.Writer.
+type writerSink struct {
+	formatter LogFormatter
+	out       io.Writer
+	isTerm    bool
+	onError   func(err error)
+}
+
+// Emit implements Sink.
+func (s *writerSink) Emit(_ context.Context, param LogFormatterParams) {
+	param.isTerm = s.isTerm
+	if _, err := fmt.Fprint(s.out, s.formatter(param)); err != nil && s.onError != nil {
+		s.onError(err)
+	}
+}
+
+// maxStackDepth is the maximum number of frames kept in a panic stack trace.
+const maxStackDepth = 32
+
+// panicStack returns the stack of the panicking goroutine, skipping the
+// given number of callers and every frame inside the runtime.
+func panicStack(skip int) string {
+	pc := make([]uintptr, maxStackDepth)
+	frames := runtime.CallersFrames(pc[:runtime.Callers(skip, pc)])
+
+	var b strings.Builder
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "runtime.") {
+			fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		}
+		if !more {
+			return b.String()
+		}
+	}
+}
+
+// isTerminal reports whether out is a terminal able to display colors.
+func isTerminal(out io.Writer) bool {
+	w, ok := out.(*os.File)
+	if !ok || os.Getenv("TERM") == "dumb" ||
+		(!isatty.IsTerminal(w.Fd()) && !isatty.IsCygwinTerminal(w.Fd())) {
+		return false
+	}
+	return true
 }
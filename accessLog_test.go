@@ -7,6 +7,7 @@ import (
 	"github.com/cloudwego/hertz/pkg/app"
 	"github.com/cloudwego/hertz/pkg/app/server"
 	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
 	"github.com/cloudwego/hertz/pkg/common/ut"
 	"github.com/cloudwego/hertz/pkg/route"
 	"github.com/stretchr/testify/assert"
@@ -239,6 +240,18 @@ func TestDefaultLogFormatter(t *testing.T) {
 
 	assert.Equal(t, "[Hertz] 2018/12/07 - 09:11:42 |\x1b[97;42m 200 \x1b[0m|            5s |     20.20.20.20 |\x1b[97;44m GET     \x1b[0m \"/\"\n", defaultLogFormatter(termTrueParam))
 	assert.Equal(t, "[Hertz] 2018/12/07 - 09:11:42 |\x1b[97;42m 200 \x1b[0m|    2743h29m3s |     20.20.20.20 |\x1b[97;44m GET     \x1b[0m \"/\"\n", defaultLogFormatter(termTrueLongDurationParam))
+
+	detailsParam := termFalseParam
+	detailsParam.Proto = "HTTP/1.1"
+	detailsParam.Scheme = "https"
+	detailsParam.TLSVersion = "TLS 1.3"
+	detailsParam.TLSCipherSuite = "TLS_AES_128_GCM_SHA256"
+	detailsParam.RequestBodySize = 12
+	detailsParam.BodySize = 345
+	detailsParam.RemoteIP = "20.20.20.20"
+	detailsParam.RemotePort = 5555
+	detailsParam.LocalAddr = "10.0.0.1:443"
+	assert.Equal(t, "[Hertz] 2018/12/07 - 09:11:42 | 200 |            5s |     20.20.20.20 | GET      \"/\" | HTTP/1.1 https TLS 1.3 TLS_AES_128_GCM_SHA256 | in 12 out 345 | 20.20.20.20:5555 -> 10.0.0.1:443\n", defaultLogFormatter(detailsParam))
 }
 
 func TestColorForMethod(t *testing.T) {
@@ -396,3 +409,58 @@ func TestForceConsoleColor(t *testing.T) {
 	// reset console color mode.
 	consoleColorMode = autoColor
 }
+
+func TestLoggerWithConfigRecover(t *testing.T) {
+	var gotParam LogFormatterParams
+	buffer := new(bytes.Buffer)
+	router := route.NewEngine(config.NewOptions([]config.Option{}))
+	router.Use(LoggerWithConfig(LoggerConfig{
+		Output:         buffer,
+		Recover:        true,
+		RecoverHandler: AbortOnPanic,
+		Formatter: func(param LogFormatterParams) string {
+			gotParam = param
+			return defaultLogFormatter(param)
+		},
+	}))
+	router.GET("/panic", func(c context.Context, ctx *app.RequestContext) {
+		panic("boom")
+	})
+	router.GET("/teapot", func(c context.Context, ctx *app.RequestContext) {
+		ctx.String(http.StatusTeapot, "short and stout")
+		panic("boom")
+	})
+
+	w := ut.PerformRequest(router, "GET", "/panic", nil)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, buffer.String(), "500")
+	assert.Contains(t, buffer.String(), "panic: boom")
+	assert.Equal(t, "boom", gotParam.Panic)
+	assert.Contains(t, gotParam.Stack, "TestLoggerWithConfigRecover")
+	assert.NotContains(t, gotParam.Stack, "runtime.gopanic")
+	assert.Equal(t, hlog.LevelError, gotParam.Level())
+
+	buffer.Reset()
+	w = ut.PerformRequest(router, "GET", "/teapot", nil)
+	assert.Equal(t, http.StatusTeapot, w.Code)
+	assert.Contains(t, buffer.String(), "418")
+	assert.Equal(t, hlog.LevelError, gotParam.Level())
+}
+
+func TestLoggerWithConfigRecoverRepanics(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	router := route.NewEngine(config.NewOptions([]config.Option{}))
+	router.Use(LoggerWithConfig(LoggerConfig{
+		Output:  buffer,
+		Recover: true,
+	}))
+	router.GET("/panic", func(c context.Context, ctx *app.RequestContext) {
+		panic("boom")
+	})
+
+	assert.PanicsWithValue(t, "boom", func() {
+		_ = ut.PerformRequest(router, "GET", "/panic", nil)
+	})
+	assert.Contains(t, buffer.String(), "500")
+	assert.Contains(t, buffer.String(), "panic: boom")
+}
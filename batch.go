@@ -0,0 +1,237 @@
+package accessLog
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BatchConfig defines how an exporter batches events and retries failed sends.
+type BatchConfig struct {
+	// MaxSize is the maximum number of events sent at once.
+	// Optional. Default value is 512.
+	MaxSize int
+
+	// MaxBytes is the maximum encoded size of the events sent at once, for
+	// the exporters encoding events as they are queued, such as Webhook.
+	// Optional. Default value is 0, no limit.
+	MaxBytes int
+
+	// FlushInterval is the maximum time an event waits for its batch to fill.
+	// Optional. Default value is 1 second.
+	FlushInterval time.Duration
+
+	// QueueSize is the number of events waiting to be sent. Events arriving
+	// while the queue is full are dropped.
+	// Optional. Default value is 4096.
+	QueueSize int
+
+	// MaxRetries is the number of times a failed batch is sent again before
+	// it is dropped, negative to never retry.
+	// Optional. Default value is 5.
+	MaxRetries int
+
+	// MinBackoff is the wait before the first retry, doubled after each
+	// attempt up to MaxBackoff. Waits are jittered.
+	// Optional. Default value is 100 milliseconds.
+	MinBackoff time.Duration
+
+	// MaxBackoff is the maximum wait between two attempts, including the
+	// waits asked for with Retry-After.
+	// Optional. Default value is 10 seconds.
+	MaxBackoff time.Duration
+}
+
+func (conf BatchConfig) withDefaults() BatchConfig {
+	if conf.MaxSize <= 0 {
+		conf.MaxSize = 512
+	}
+	if conf.FlushInterval <= 0 {
+		conf.FlushInterval = time.Second
+	}
+	if conf.QueueSize <= 0 {
+		conf.QueueSize = 4096
+	}
+	if conf.MaxRetries < 0 {
+		conf.MaxRetries = 0
+	} else if conf.MaxRetries == 0 {
+		conf.MaxRetries = 5
+	}
+	if conf.MinBackoff <= 0 {
+		conf.MinBackoff = 100 * time.Millisecond
+	}
+	if conf.MaxBackoff < conf.MinBackoff {
+		conf.MaxBackoff = 10 * time.Second
+		if conf.MaxBackoff < conf.MinBackoff {
+			conf.MaxBackoff = conf.MinBackoff
+		}
+	}
+	return conf
+}
+
+// backoff returns the jittered wait before retry attempt, counted from 1.
+func (conf BatchConfig) backoff(attempt int) time.Duration {
+	d := conf.MinBackoff
+	for i := 1; i < attempt && d < conf.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > conf.MaxBackoff {
+		d = conf.MaxBackoff
+	}
+	// equal jitter: wait between half and the whole backoff
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// permanentError is an error retrying cannot fix, such as a rejected payload.
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// retryAfterError is a retryable error asking to wait delay before the next attempt.
+type retryAfterError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *retryAfterError) Error() string { return e.err.Error() }
+func (e *retryAfterError) Unwrap() error { return e.err }
+
+// retry calls send until it succeeds, fails with a permanentError, the
+// retries are exhausted or ctx is done, returning the last error.
+func (conf BatchConfig) retry(ctx context.Context, send func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = send(); err == nil {
+			return nil
+		}
+		var perm *permanentError
+		if errors.As(err, &perm) || attempt >= conf.MaxRetries {
+			return err
+		}
+
+		wait := conf.backoff(attempt + 1)
+		var ra *retryAfterError
+		if errors.As(err, &ra) && ra.delay > wait {
+			wait = ra.delay
+			if wait > conf.MaxBackoff {
+				wait = conf.MaxBackoff
+			}
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// batcher queues items and hands them to flush in batches from its own goroutine.
+type batcher[T any] struct {
+	conf   BatchConfig
+	flush  func(ctx context.Context, batch []T)
+	size   func(item T) int
+	items  chan T
+	done   chan struct{}
+	once   sync.Once
+	closed chan struct{}
+	mu     sync.RWMutex
+	drops  uint64
+}
+
+func newBatcher[T any](conf BatchConfig, flush func(ctx context.Context, batch []T)) *batcher[T] {
+	return newSizedBatcher(conf, nil, flush)
+}
+
+// newSizedBatcher returns a batcher also bounding the size of a batch to
+// conf.MaxBytes, as measured by size.
+func newSizedBatcher[T any](conf BatchConfig, size func(item T) int, flush func(ctx context.Context, batch []T)) *batcher[T] {
+	b := &batcher[T]{
+		conf:   conf,
+		flush:  flush,
+		size:   size,
+		items:  make(chan T, conf.QueueSize),
+		done:   make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// add queues item, dropping it when the queue is full or the batcher is closed.
+func (b *batcher[T]) add(item T) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	select {
+	case <-b.closed:
+		atomic.AddUint64(&b.drops, 1)
+		return
+	default:
+	}
+	select {
+	case b.items <- item:
+	default:
+		atomic.AddUint64(&b.drops, 1)
+	}
+}
+
+// dropped returns the number of items dropped because the queue was full.
+func (b *batcher[T]) dropped() uint64 {
+	return atomic.LoadUint64(&b.drops)
+}
+
+// close stops accepting items and waits for the queued ones to be flushed.
+func (b *batcher[T]) close() {
+	b.once.Do(func() {
+		b.mu.Lock()
+		close(b.closed)
+		close(b.items)
+		b.mu.Unlock()
+	})
+	<-b.done
+}
+
+func (b *batcher[T]) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.conf.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]T, 0, b.conf.MaxSize)
+	batchBytes := 0
+	send := func() {
+		if len(batch) > 0 {
+			b.flush(context.Background(), batch)
+			batch = make([]T, 0, b.conf.MaxSize)
+			batchBytes = 0
+		}
+	}
+	for {
+		select {
+		case item, ok := <-b.items:
+			if !ok {
+				send()
+				return
+			}
+			if b.size != nil && b.conf.MaxBytes > 0 {
+				n := b.size(item)
+				if batchBytes+n > b.conf.MaxBytes {
+					send()
+				}
+				batchBytes += n
+			}
+			batch = append(batch, item)
+			if len(batch) >= b.conf.MaxSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		}
+	}
+}
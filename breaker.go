@@ -0,0 +1,212 @@
+package accessLog
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBreakerOpen is returned by a BreakerWriter without Fallback while its
+// breaker is open.
+var ErrBreakerOpen = errors.New("accessLog: breaker open")
+
+// BreakerConfig defines how a BreakerWriter handles the failures of its writer.
+type BreakerConfig struct {
+	// Threshold is the number of consecutive failed writes opening the
+	// breaker. While open, writes go to Fallback.
+	// Optional. Default value is 5.
+	Threshold int
+
+	// MinBackoff is the cool-down before an open breaker tries the writer
+	// again, doubled after each failed try up to MaxBackoff. Waits are jittered.
+	// Optional. Default value is 1 second.
+	MinBackoff time.Duration
+
+	// MaxBackoff is the maximum cool-down.
+	// Optional. Default value is 1 minute.
+	MaxBackoff time.Duration
+
+	// Fallback receives the writes failing or made while the breaker is
+	// open, such as os.Stderr.
+	// Optional. Default value is nil, those writes are dropped.
+	Fallback io.Writer
+
+	// ErrorHandler is called with the errors of the writer.
+	// Optional. Default value is nil, errors are dropped.
+	ErrorHandler func(err error)
+
+	// OnStateChange is called when the breaker opens, and when it closes
+	// again because the writer recovered.
+	// Optional.
+	OnStateChange func(open bool)
+}
+
+// BreakerStats are the counters of a BreakerWriter.
+type BreakerStats struct {
+	// Writes is the number of successful writes to the writer.
+	Writes uint64
+	// Failures is the number of failed writes to the writer.
+	Failures uint64
+	// Fallbacks is the number of writes made to Fallback.
+	Fallbacks uint64
+	// Dropped is the number of writes lost.
+	Dropped uint64
+	// Trips is the number of times the breaker opened.
+	Trips uint64
+	// Open reports whether the breaker is open.
+	Open bool
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	// breakerHalfOpen is the state of an open breaker trying the writer again.
+	breakerHalfOpen
+)
+
+// BreakerWriter is an io.Writer guarding a failing writer, such as the
+// Output of a Logger, with a circuit breaker. Once open, it stops trying the
+// writer for a cool-down and routes the writes to a fallback.
+type BreakerWriter struct {
+	w    io.Writer
+	conf BreakerConfig
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	opens    int
+	retryAt  time.Time
+
+	writes    uint64
+	failed    uint64
+	fallbacks uint64
+	dropped   uint64
+	trips     uint64
+}
+
+// NewBreakerWriter instance a BreakerWriter guarding w with config.
+func NewBreakerWriter(w io.Writer, conf BreakerConfig) *BreakerWriter {
+	if conf.Threshold <= 0 {
+		conf.Threshold = 5
+	}
+	if conf.MinBackoff <= 0 {
+		conf.MinBackoff = time.Second
+	}
+	if conf.MaxBackoff < conf.MinBackoff {
+		conf.MaxBackoff = time.Minute
+		if conf.MaxBackoff < conf.MinBackoff {
+			conf.MaxBackoff = conf.MinBackoff
+		}
+	}
+	return &BreakerWriter{w: w, conf: conf}
+}
+
+// Write implements io.Writer. It fails only when p is lost: the writer
+// failed or the breaker is open, and there is no working Fallback.
+func (b *BreakerWriter) Write(p []byte) (int, error) {
+	if !b.allow() {
+		return b.fallback(p, ErrBreakerOpen)
+	}
+
+	n, err := b.w.Write(p)
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	b.record(err)
+	if err == nil {
+		atomic.AddUint64(&b.writes, 1)
+		return n, nil
+	}
+
+	atomic.AddUint64(&b.failed, 1)
+	if b.conf.ErrorHandler != nil {
+		b.conf.ErrorHandler(err)
+	}
+	return b.fallback(p, err)
+}
+
+// Stats returns the counters of b.
+func (b *BreakerWriter) Stats() BreakerStats {
+	b.mu.Lock()
+	open := b.state != breakerClosed
+	b.mu.Unlock()
+
+	return BreakerStats{
+		Writes:    atomic.LoadUint64(&b.writes),
+		Failures:  atomic.LoadUint64(&b.failed),
+		Fallbacks: atomic.LoadUint64(&b.fallbacks),
+		Dropped:   atomic.LoadUint64(&b.dropped),
+		Trips:     atomic.LoadUint64(&b.trips),
+		Open:      open,
+	}
+}
+
+// allow reports whether a write may try the writer. Once the cool-down of an
+// open breaker is over, a single write tries it.
+func (b *BreakerWriter) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerClosed:
+		return true
+	case breakerOpen:
+		if time.Now().Before(b.retryAt) {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	default:
+		return false
+	}
+}
+
+// record updates the breaker with the result of a write to the writer.
+func (b *BreakerWriter) record(err error) {
+	b.mu.Lock()
+	var changed, open bool
+	if err == nil {
+		b.failures = 0
+		b.opens = 0
+		if b.state != breakerClosed {
+			b.state = breakerClosed
+			changed = true
+		}
+	} else {
+		b.failures++
+		if b.state == breakerHalfOpen || b.failures >= b.conf.Threshold {
+			if b.state == breakerClosed {
+				atomic.AddUint64(&b.trips, 1)
+				changed, open = true, true
+			}
+			b.opens++
+			b.state = breakerOpen
+			backoff := BatchConfig{MinBackoff: b.conf.MinBackoff, MaxBackoff: b.conf.MaxBackoff}
+			b.retryAt = time.Now().Add(backoff.backoff(b.opens))
+		}
+	}
+	b.mu.Unlock()
+
+	if changed && b.conf.OnStateChange != nil {
+		b.conf.OnStateChange(open)
+	}
+}
+
+// fallback writes p to Fallback, returning err when there is none.
+func (b *BreakerWriter) fallback(p []byte, err error) (int, error) {
+	if b.conf.Fallback == nil {
+		atomic.AddUint64(&b.dropped, 1)
+		return 0, err
+	}
+	n, ferr := b.conf.Fallback.Write(p)
+	if ferr != nil {
+		atomic.AddUint64(&b.dropped, 1)
+		return n, ferr
+	}
+	atomic.AddUint64(&b.fallbacks, 1)
+	return len(p), nil
+}
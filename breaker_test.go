@@ -0,0 +1,119 @@
+package accessLog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/stretchr/testify/assert"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingWriter fails every write while down.
+type failingWriter struct {
+	down atomic.Bool
+	buf  bytes.Buffer
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.down.Load() {
+		return 0, errors.New("disk full")
+	}
+	return w.buf.Write(p)
+}
+
+func TestBreakerWriter(t *testing.T) {
+	out := &failingWriter{}
+	out.down.Store(true)
+	fallback := new(bytes.Buffer)
+	var errs int
+	var states []bool
+	w := NewBreakerWriter(out, BreakerConfig{
+		Threshold:     2,
+		MinBackoff:    20 * time.Millisecond,
+		MaxBackoff:    20 * time.Millisecond,
+		Fallback:      fallback,
+		ErrorHandler:  func(error) { errs++ },
+		OnStateChange: func(open bool) { states = append(states, open) },
+	})
+
+	for _, line := range []string{"a\n", "b\n", "c\n"} {
+		n, err := w.Write([]byte(line))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, n)
+	}
+	// the third write skipped the open breaker
+	assert.Equal(t, 2, errs)
+	assert.Equal(t, "a\nb\nc\n", fallback.String())
+	assert.Equal(t, BreakerStats{Failures: 2, Fallbacks: 3, Trips: 1, Open: true}, w.Stats())
+
+	// a failed try after the cool-down opens the breaker again
+	time.Sleep(25 * time.Millisecond)
+	_, _ = w.Write([]byte("d\n"))
+	assert.Equal(t, 3, errs)
+	assert.True(t, w.Stats().Open)
+
+	out.down.Store(false)
+	_, _ = w.Write([]byte("e\n"))
+	assert.Empty(t, out.buf.String())
+	time.Sleep(25 * time.Millisecond)
+	_, _ = w.Write([]byte("f\n"))
+	assert.Equal(t, "f\n", out.buf.String())
+	assert.Equal(t, BreakerStats{Writes: 1, Failures: 3, Fallbacks: 5, Trips: 1}, w.Stats())
+	assert.Equal(t, []bool{true, false}, states)
+}
+
+func TestBreakerWriterWithoutFallback(t *testing.T) {
+	out := &failingWriter{}
+	out.down.Store(true)
+	w := NewBreakerWriter(out, BreakerConfig{Threshold: 1, MinBackoff: time.Minute})
+
+	router := route.NewEngine(config.NewOptions([]config.Option{}))
+	router.Use(LoggerWithConfig(LoggerConfig{Output: w}))
+	router.GET("/example", func(c context.Context, ctx *app.RequestContext) {})
+	_ = ut.PerformRequest(router, "GET", "/example", nil)
+	_ = ut.PerformRequest(router, "GET", "/example", nil)
+
+	_, err := w.Write([]byte("x"))
+	assert.ErrorIs(t, err, ErrBreakerOpen)
+	assert.Equal(t, BreakerStats{Failures: 1, Dropped: 3, Trips: 1, Open: true}, w.Stats())
+}
+
+func TestLoggerErrorHandler(t *testing.T) {
+	out := &failingWriter{}
+	out.down.Store(true)
+	var errs, outputErrs []error
+	router := route.NewEngine(config.NewOptions([]config.Option{}))
+	router.Use(LoggerWithConfig(LoggerConfig{
+		Output:       out,
+		ErrorHandler: func(err error) { errs = append(errs, err) },
+	}))
+	router.Use(LoggerWithConfig(LoggerConfig{
+		Outputs: []Output{
+			{Writer: out},
+			{Writer: out, ErrorHandler: func(err error) { outputErrs = append(outputErrs, err) }},
+			{Writer: NewBreakerWriter(out, BreakerConfig{Threshold: 1, MinBackoff: time.Minute})},
+		},
+		ErrorHandler: func(err error) { errs = append(errs, err) },
+	}))
+	router.GET("/example", func(c context.Context, ctx *app.RequestContext) {})
+	_ = ut.PerformRequest(router, "GET", "/example", nil)
+
+	if assert.Len(t, errs, 3) {
+		assert.EqualError(t, errs[0], "disk full")
+		assert.EqualError(t, errs[1], "disk full")
+		assert.EqualError(t, errs[2], "disk full")
+	}
+	assert.Len(t, outputErrs, 1)
+
+	// the inner Logger, with the Outputs, logs first
+	_ = ut.PerformRequest(router, "GET", "/example", nil)
+	if assert.Len(t, errs, 6) {
+		assert.ErrorIs(t, errs[4], ErrBreakerOpen)
+	}
+}
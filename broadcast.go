@@ -0,0 +1,209 @@
+package accessLog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"io"
+	"sync"
+	"time"
+)
+
+// BroadcasterConfig defines the config for Broadcaster.
+type BroadcasterConfig struct {
+	// MaxSubscribers is the maximum number of concurrent subscribers.
+	// Optional. Default value is 10.
+	MaxSubscribers int
+
+	// BufferSize is the number of events buffered per subscriber. Events
+	// arriving while the buffer of a slow subscriber is full are dropped.
+	// Optional. Default value is 256.
+	BufferSize int
+
+	// Heartbeat is the interval of the comments keeping idle streams alive
+	// and detecting disconnected clients.
+	// Optional. Default value is 15 seconds.
+	Heartbeat time.Duration
+}
+
+// Broadcaster is a Sink streaming access events to the clients of its
+// Server-Sent Events handler, like tail -f over HTTP.
+type Broadcaster struct {
+	conf BroadcasterConfig
+
+	mu     sync.Mutex
+	subs   map[*subscriber]struct{}
+	closed bool
+}
+
+// subscriber receives the events matching its filter.
+type subscriber struct {
+	filter  EventFilter
+	events  chan LogFormatterParams
+	done    chan struct{}
+	once    sync.Once
+	mu      sync.Mutex
+	dropped int
+}
+
+// NewBroadcaster instance a Broadcaster with config.
+func NewBroadcaster(conf BroadcasterConfig) *Broadcaster {
+	if conf.MaxSubscribers <= 0 {
+		conf.MaxSubscribers = 10
+	}
+	if conf.BufferSize <= 0 {
+		conf.BufferSize = 256
+	}
+	if conf.Heartbeat <= 0 {
+		conf.Heartbeat = 15 * time.Second
+	}
+	return &Broadcaster{conf: conf, subs: make(map[*subscriber]struct{})}
+}
+
+// Emit implements Sink. It never blocks on a slow subscriber.
+func (b *Broadcaster) Emit(_ context.Context, param LogFormatterParams) {
+	param.Request = nil
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subs {
+		if !s.filter.Match(&param) {
+			continue
+		}
+		select {
+		case s.events <- param:
+		default:
+			s.mu.Lock()
+			s.dropped++
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Subscribers returns the number of connected subscribers.
+func (b *Broadcaster) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// Close disconnects every subscriber and refuses new ones.
+func (b *Broadcaster) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for s := range b.subs {
+		delete(b.subs, s)
+		s.close()
+	}
+	return nil
+}
+
+// Handler returns a Hertz handler streaming the access events as
+// Server-Sent Events, one JSON object per event. Events are selected by the
+// query arguments ParseEventFilter reads. A comment reports the events dropped
+// because the client was too slow.
+func (b *Broadcaster) Handler() app.HandlerFunc {
+	return func(c context.Context, ctx *app.RequestContext) {
+		filter, err := ParseEventFilter(ctx.QueryArgs())
+		if err != nil {
+			ctx.AbortWithMsg(err.Error(), consts.StatusBadRequest)
+			return
+		}
+
+		s, ok := b.subscribe(filter)
+		if !ok {
+			ctx.AbortWithMsg("too many subscribers", consts.StatusServiceUnavailable)
+			return
+		}
+
+		ctx.SetContentType("text/event-stream")
+		ctx.Response.Header.Set("Cache-Control", "no-cache")
+		ctx.Response.ImmediateHeaderFlush = true
+		ctx.SetBodyStream(&sseStream{b: b, s: s, heartbeat: time.NewTicker(b.conf.Heartbeat)}, -1)
+	}
+}
+
+// subscribe adds a subscriber, unless the Broadcaster is full or closed.
+func (b *Broadcaster) subscribe(filter EventFilter) (*subscriber, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed || len(b.subs) >= b.conf.MaxSubscribers {
+		return nil, false
+	}
+
+	s := &subscriber{
+		filter: filter,
+		events: make(chan LogFormatterParams, b.conf.BufferSize),
+		done:   make(chan struct{}),
+	}
+	b.subs[s] = struct{}{}
+	return s, true
+}
+
+// unsubscribe removes s.
+func (b *Broadcaster) unsubscribe(s *subscriber) {
+	b.mu.Lock()
+	delete(b.subs, s)
+	b.mu.Unlock()
+	s.close()
+}
+
+func (s *subscriber) close() {
+	s.once.Do(func() { close(s.done) })
+}
+
+// takeDropped returns and resets the number of events dropped.
+func (s *subscriber) takeDropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.dropped
+	s.dropped = 0
+	return n
+}
+
+// sseStream is the response body stream of a subscriber. Hertz writes every
+// read as a chunk and flushes it, so events reach the client right away.
+type sseStream struct {
+	b         *Broadcaster
+	s         *subscriber
+	heartbeat *time.Ticker
+	buf       bytes.Buffer
+}
+
+// Read implements io.Reader, blocking until an event or a heartbeat is due.
+func (r *sseStream) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 {
+		select {
+		case param := <-r.s.events:
+			if n := r.s.takeDropped(); n > 0 {
+				fmt.Fprintf(&r.buf, ": dropped %d events\n\n", n)
+			}
+			data, err := json.Marshal(newJSONEvent(&param))
+			if err != nil {
+				continue
+			}
+			r.buf.WriteString("data: ")
+			r.buf.Write(data)
+			r.buf.WriteString("\n\n")
+		case <-r.heartbeat.C:
+			r.buf.WriteString(": ping\n\n")
+		case <-r.s.done:
+			return 0, io.EOF
+		}
+	}
+	return r.buf.Read(p)
+}
+
+// Close implements io.Closer. Hertz closes the stream once the client is gone.
+func (r *sseStream) Close() error {
+	r.heartbeat.Stop()
+	r.b.unsubscribe(r.s)
+	return nil
+}
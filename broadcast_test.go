@@ -0,0 +1,82 @@
+package accessLog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBroadcasterHandler(t *testing.T) {
+	b := NewBroadcaster(BroadcasterConfig{MaxSubscribers: 1, Heartbeat: 50 * time.Millisecond})
+	defer b.Close()
+
+	addr := freeAddr(t)
+	h := server.New(server.WithHostPorts(addr))
+	h.GET("/debug/accesslog/tail", b.Handler())
+	spinServer(t, h, addr)
+
+	resp, err := noKeepAliveClient.Get("http://" + addr + "/debug/accesslog/tail?status=5xx")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, 1, b.Subscribers())
+
+	// the subscriber cap is enforced
+	busy, err := noKeepAliveClient.Get("http://" + addr + "/debug/accesslog/tail")
+	assert.NoError(t, err)
+	busy.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, busy.StatusCode)
+
+	b.Emit(context.Background(), LogFormatterParams{StatusCode: 200, Path: "/ok"})
+	b.Emit(context.Background(), LogFormatterParams{StatusCode: 502, Path: "/fail"})
+
+	r := bufio.NewReader(resp.Body)
+	var sawPing bool
+	for {
+		line, err := r.ReadString('\n')
+		assert.NoError(t, err)
+		if line == ": ping\n" {
+			sawPing = true
+		}
+		if strings.HasPrefix(line, "data: ") {
+			var event map[string]any
+			assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event))
+			assert.Equal(t, "/fail", event["path"])
+			assert.Equal(t, float64(502), event["status"])
+			break
+		}
+	}
+
+	// wait for a heartbeat, then the disconnection is noticed on the next write
+	for !sawPing {
+		line, err := r.ReadString('\n')
+		assert.NoError(t, err)
+		sawPing = line == ": ping\n"
+	}
+	resp.Body.Close()
+	assert.Eventually(t, func() bool { return b.Subscribers() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestBroadcasterDropsForSlowSubscribers(t *testing.T) {
+	b := NewBroadcaster(BroadcasterConfig{BufferSize: 2})
+	s, ok := b.subscribe(EventFilter{})
+	assert.True(t, ok)
+
+	for i := 0; i < 5; i++ {
+		b.Emit(context.Background(), LogFormatterParams{StatusCode: 200})
+	}
+	assert.Len(t, s.events, 2)
+	assert.Equal(t, 3, s.takeDropped())
+	assert.Equal(t, 0, s.takeDropped())
+
+	assert.NoError(t, b.Close())
+	_, ok = b.subscribe(EventFilter{})
+	assert.False(t, ok)
+	assert.Equal(t, 0, b.Subscribers())
+}
@@ -0,0 +1,113 @@
+package accessLog
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/network"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// setConnParams fills the request size, protocol and connection details of param.
+func setConnParams(param *LogFormatterParams, ctx *app.RequestContext) {
+	param.RequestContentLength = ctx.Request.Header.ContentLength()
+	if param.RequestContentLength < 0 {
+		param.RequestContentLength = -1
+	}
+
+	if ctx.Request.IsBodyStream() {
+		// Reading a streamed body would consume it, its size is unknown.
+		param.RequestBodySize = -1
+	} else {
+		param.RequestBodySize = len(ctx.Request.Body())
+	}
+
+	if raw := ctx.Request.Header.RawHeaders(); len(raw) > 0 {
+		param.RequestHeaderSize = len(raw)
+	} else {
+		param.RequestHeaderSize = len(ctx.Request.Header.Header())
+	}
+
+	param.Proto = ctx.Request.Header.GetProtocol()
+	if param.Proto == "" {
+		param.Proto = consts.HTTP10
+		if ctx.Request.Header.IsHTTP11() {
+			param.Proto = consts.HTTP11
+		}
+	}
+
+	if conn, ok := ctx.GetConn().(network.ConnTLSer); ok {
+		state := conn.ConnectionState()
+		param.TLSVersion = tls.VersionName(state.Version)
+		param.TLSCipherSuite = tls.CipherSuiteName(state.CipherSuite)
+	}
+	param.Scheme = requestScheme(ctx, param.TLSVersion != "")
+
+	if host, port, err := net.SplitHostPort(ctx.RemoteAddr().String()); err == nil {
+		param.RemoteIP = host
+		param.RemotePort, _ = strconv.Atoi(port)
+	}
+
+	if conn := ctx.GetConn(); conn != nil && conn.LocalAddr() != nil {
+		param.LocalAddr = conn.LocalAddr().String()
+	}
+}
+
+// requestScheme returns the scheme the client used, honoring the
+// X-Forwarded-Proto and Forwarded headers set by proxies.
+func requestScheme(ctx *app.RequestContext, isTLS bool) string {
+	if proto := ctx.Request.Header.Get("X-Forwarded-Proto"); proto != "" {
+		proto, _, _ = strings.Cut(proto, ",")
+		return strings.ToLower(strings.TrimSpace(proto))
+	}
+
+	if forwarded := ctx.Request.Header.Get("Forwarded"); forwarded != "" {
+		first, _, _ := strings.Cut(forwarded, ",")
+		for _, pair := range strings.Split(first, ";") {
+			k, v, _ := strings.Cut(strings.TrimSpace(pair), "=")
+			if strings.EqualFold(k, "proto") {
+				return strings.ToLower(strings.Trim(v, `"`))
+			}
+		}
+	}
+
+	if isTLS {
+		return "https"
+	}
+	if scheme := ctx.Request.URI().Scheme(); len(scheme) > 0 {
+		return string(scheme)
+	}
+	return "http"
+}
+
+// protocolDetails returns the protocol, sizes and addresses of param as a
+// suffix of the built-in formatters, empty when they are not known.
+func protocolDetails(param *LogFormatterParams) string {
+	if param.Proto == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(" | ")
+	b.WriteString(param.Proto)
+	if param.Scheme != "" {
+		b.WriteString(" " + param.Scheme)
+	}
+	if param.TLSVersion != "" {
+		b.WriteString(" " + param.TLSVersion)
+		if param.TLSCipherSuite != "" {
+			b.WriteString(" " + param.TLSCipherSuite)
+		}
+	}
+	fmt.Fprintf(&b, " | in %d out %d", param.RequestBodySize, param.BodySize)
+	if param.RemoteIP != "" {
+		b.WriteString(" | " + net.JoinHostPort(param.RemoteIP, strconv.Itoa(param.RemotePort)))
+		if param.LocalAddr != "" {
+			b.WriteString(" -> " + param.LocalAddr)
+		}
+	}
+	return b.String()
+}
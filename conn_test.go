@@ -0,0 +1,41 @@
+package accessLog
+
+import (
+	"bytes"
+	"context"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLoggerConnParams(t *testing.T) {
+	var gotParam LogFormatterParams
+	router := route.NewEngine(config.NewOptions([]config.Option{}))
+	router.Use(LoggerWithConfig(LoggerConfig{
+		Sink: SinkFunc(func(c context.Context, param LogFormatterParams) {
+			gotParam = param
+		}),
+	}))
+	router.POST("/example", func(c context.Context, ctx *app.RequestContext) {})
+
+	body := []byte("hello world")
+	_ = ut.PerformRequest(router, "POST", "/example", &ut.Body{Body: bytes.NewReader(body), Len: len(body)},
+		ut.Header{Key: "Content-Length", Value: "11"})
+	assert.Equal(t, 11, gotParam.RequestBodySize)
+	assert.Equal(t, 11, gotParam.RequestContentLength)
+	assert.Greater(t, gotParam.RequestHeaderSize, 0)
+	assert.Equal(t, "HTTP/1.1", gotParam.Proto)
+	assert.Equal(t, "http", gotParam.Scheme)
+	assert.Equal(t, "0.0.0.0", gotParam.RemoteIP)
+	assert.Empty(t, gotParam.TLSVersion)
+
+	_ = ut.PerformRequest(router, "POST", "/example", nil, ut.Header{Key: "X-Forwarded-Proto", Value: "HTTPS, http"})
+	assert.Equal(t, 0, gotParam.RequestBodySize)
+	assert.Equal(t, "https", gotParam.Scheme)
+
+	_ = ut.PerformRequest(router, "POST", "/example", nil, ut.Header{Key: "Forwarded", Value: `for=1.2.3.4; proto="https", proto=http`})
+	assert.Equal(t, "https", gotParam.Scheme)
+}
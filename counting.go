@@ -0,0 +1,93 @@
+package accessLog
+
+import (
+	"github.com/cloudwego/hertz/pkg/network"
+	"io"
+	"sync"
+)
+
+// countingBodyStream wraps a response body stream to count the bytes sent,
+// calling done with the total once the stream is closed.
+type countingBodyStream struct {
+	r    io.Reader
+	n    int
+	once sync.Once
+	done func(n int)
+}
+
+// Read implements io.Reader.
+func (s *countingBodyStream) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.n += n
+	return n, err
+}
+
+// Close implements io.Closer. Hertz closes the stream once it has been written.
+func (s *countingBodyStream) Close() error {
+	var err error
+	if c, ok := s.r.(io.Closer); ok {
+		err = c.Close()
+	}
+	s.once.Do(func() { s.done(s.n) })
+	return err
+}
+
+// countingConn wraps a hijacked connection to count the bytes read and written.
+type countingConn struct {
+	network.Conn
+	read    int64
+	written int64
+}
+
+// Read implements net.Conn.
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.read += int64(n)
+	return n, err
+}
+
+// Write implements net.Conn.
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.written += int64(n)
+	return n, err
+}
+
+// Skip implements network.Reader.
+func (c *countingConn) Skip(n int) error {
+	err := c.Conn.Skip(n)
+	if err == nil {
+		c.read += int64(n)
+	}
+	return err
+}
+
+// ReadByte implements network.Reader.
+func (c *countingConn) ReadByte() (byte, error) {
+	b, err := c.Conn.ReadByte()
+	if err == nil {
+		c.read++
+	}
+	return b, err
+}
+
+// ReadBinary implements network.Reader.
+func (c *countingConn) ReadBinary(n int) ([]byte, error) {
+	p, err := c.Conn.ReadBinary(n)
+	c.read += int64(len(p))
+	return p, err
+}
+
+// Malloc implements network.Writer. The buffer is sent on the next Flush.
+func (c *countingConn) Malloc(n int) ([]byte, error) {
+	buf, err := c.Conn.Malloc(n)
+	c.written += int64(len(buf))
+	return buf, err
+}
+
+// WriteBinary implements network.Writer.
+func (c *countingConn) WriteBinary(b []byte) (int, error) {
+	n, err := c.Conn.WriteBinary(b)
+	c.written += int64(n)
+	return n, err
+}
@@ -0,0 +1,78 @@
+package accessLog
+
+import (
+	"context"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/test/mock"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/network"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoggerStreamedBody(t *testing.T) {
+	var params []LogFormatterParams
+	router := route.NewEngine(config.NewOptions([]config.Option{}))
+	router.Use(LoggerWithConfig(LoggerConfig{
+		Sink: SinkFunc(func(c context.Context, param LogFormatterParams) {
+			params = append(params, param)
+		}),
+	}))
+	router.GET("/chunked", func(c context.Context, ctx *app.RequestContext) {
+		ctx.SetBodyStream(strings.NewReader("hello world"), -1)
+	})
+	router.GET("/sized", func(c context.Context, ctx *app.RequestContext) {
+		ctx.SetBodyStream(strings.NewReader("hello"), 5)
+	})
+
+	w := ut.PerformRequest(router, "GET", "/chunked", nil)
+	assert.Equal(t, "hello world", w.Body.String())
+	assert.Len(t, params, 1)
+	assert.Equal(t, 11, params[0].BodySize)
+	assert.Equal(t, -1, params[0].ContentLength)
+
+	params = nil
+	_ = ut.PerformRequest(router, "GET", "/sized", nil)
+	assert.Len(t, params, 1)
+	assert.Equal(t, 5, params[0].BodySize)
+	assert.Equal(t, 5, params[0].ContentLength)
+}
+
+func TestLoggerHijackedConn(t *testing.T) {
+	var params []LogFormatterParams
+	var hijack app.HijackHandler
+	router := route.NewEngine(config.NewOptions([]config.Option{}))
+	router.Use(func(c context.Context, ctx *app.RequestContext) {
+		ctx.Next(c)
+		hijack = ctx.GetHijackHandler()
+	})
+	router.Use(LoggerWithConfig(LoggerConfig{
+		Sink: SinkFunc(func(c context.Context, param LogFormatterParams) {
+			params = append(params, param)
+		}),
+	}))
+	router.GET("/ws", func(c context.Context, ctx *app.RequestContext) {
+		ctx.SetStatusCode(101)
+		ctx.Hijack(func(conn network.Conn) {
+			_, _ = conn.ReadBinary(4)
+			_, _ = conn.Write([]byte("pong!"))
+			time.Sleep(time.Millisecond)
+		})
+	})
+
+	_ = ut.PerformRequest(router, "GET", "/ws", nil)
+	assert.Len(t, params, 1)
+	assert.Equal(t, 101, params[0].StatusCode)
+	assert.False(t, params[0].Hijacked)
+
+	hijack(mock.NewConn("ping"))
+	assert.Len(t, params, 2)
+	assert.True(t, params[1].Hijacked)
+	assert.Equal(t, int64(4), params[1].ConnBytesRead)
+	assert.Equal(t, int64(5), params[1].ConnBytesWritten)
+	assert.Greater(t, params[1].Latency, params[0].Latency)
+}
@@ -0,0 +1,781 @@
+package accessLog
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BatchSink is implemented by the sinks able to deliver a batch of events
+// synchronously, such as OTLPExporter or Elasticsearch, bypassing their own
+// queue. EmitBatch returns nil once the whole batch is accepted.
+type BatchSink interface {
+	EmitBatch(c context.Context, params []LogFormatterParams) error
+}
+
+// FsyncPolicy defines when a DurableQueue syncs its segments to disk.
+type FsyncPolicy int
+
+const (
+	// FsyncInterval syncs every SyncInterval, losing at most the events of
+	// the last interval on a power failure.
+	FsyncInterval FsyncPolicy = iota
+	// FsyncAlways syncs every event before Emit returns.
+	FsyncAlways
+	// FsyncNever leaves syncing to the operating system. Events survive a
+	// crash of the process, but not of the machine.
+	FsyncNever
+)
+
+// DurableQueueConfig defines the config for DurableQueue.
+type DurableQueueConfig struct {
+	// Dir is the directory of the segments and checkpoints.
+	Dir string
+
+	// Sinks are the consumers of the queue, by name. Each one reads the queue
+	// at its own pace and keeps its own checkpoint, named after it.
+	Sinks map[string]Sink
+
+	// Fsync defines when segments are synced to disk.
+	// Optional. Default value is FsyncInterval.
+	Fsync FsyncPolicy
+
+	// SyncInterval is the interval of FsyncInterval.
+	// Optional. Default value is 1 second.
+	SyncInterval time.Duration
+
+	// SegmentSize is the size a segment is rolled over at.
+	// Optional. Default value is 16 MiB.
+	SegmentSize int64
+
+	// MaxBytes caps the size of the queue. Past it, the oldest segments are
+	// evicted, even if some sinks have not read them yet.
+	// Optional. Default value is 1 GiB.
+	MaxBytes int64
+
+	// Batch defines the maximum number of events delivered at once to a
+	// BatchSink and the backoff between failed deliveries. Deliveries are
+	// retried until they succeed.
+	Batch BatchConfig
+
+	// ErrorHandler is called with the failed writes and deliveries and the
+	// evicted segments. It must not call the methods of the queue.
+	// Optional. Default value is nil, errors are dropped.
+	ErrorHandler func(err error)
+}
+
+// DurableQueue is a Sink writing access events ahead to segment files on
+// disk and delivering them to its sinks from there, so that events survive
+// an unavailable collector or a restart of the process.
+//
+// A BatchSink is checkpointed once EmitBatch succeeds, so its events are
+// delivered at least once: OTLPExporter, SpanExporter, Loki, Elasticsearch,
+// Webhook, Fluent and GELF over TCP. Any other Sink is checkpointed once Emit
+// returns, and may still drop the events it queues.
+type DurableQueue struct {
+	conf DurableQueueConfig
+
+	mu        sync.Mutex
+	segments  []durableSegment
+	head      *os.File
+	dirty     bool
+	closed    bool
+	evicted   int64
+	consumers []*durableConsumer
+
+	// ctx is done once the queue is closing, interrupting the deliveries.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	once   sync.Once
+}
+
+// durableSegment is a segment file, holding records of
+// [4-byte length][4-byte CRC-32][JSON event], little endian.
+type durableSegment struct {
+	id   uint64
+	size int64
+}
+
+// durableConsumer delivers the queue to a sink from its position, the
+// segment and offset of its next record.
+type durableConsumer struct {
+	name string
+	sink Sink
+	seg  uint64
+	off  int64
+	wake chan struct{}
+}
+
+// durableRecord is the JSON representation of an event in a segment.
+// Request is not kept, only the request headers the sinks read.
+type durableRecord struct {
+	LogFormatterParams
+	Panic       string            `json:",omitempty"`
+	ServerError string            `json:",omitempty"`
+	Headers     map[string]string `json:",omitempty"`
+}
+
+// durableHeaders are the request headers kept in a durableRecord: the trace
+// context of spans and OTLP records, and the user agent of ECS and OTLP.
+var durableHeaders = []string{"traceparent", "tracestate", "User-Agent"}
+
+const durableHeaderSize = 8
+
+// NewDurableQueue instance a DurableQueue with config, recovering the
+// segments and checkpoints left in Dir by a previous process. The tail of a
+// segment torn by a crash is truncated. A sink without a checkpoint starts
+// at the oldest segment.
+func NewDurableQueue(conf DurableQueueConfig) (*DurableQueue, error) {
+	if conf.Dir == "" {
+		return nil, errors.New("durable queue: no directory")
+	}
+	if len(conf.Sinks) == 0 {
+		return nil, errors.New("durable queue: no sinks")
+	}
+	for name := range conf.Sinks {
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			return nil, fmt.Errorf("durable queue: invalid sink name %q", name)
+		}
+	}
+	if conf.SyncInterval <= 0 {
+		conf.SyncInterval = time.Second
+	}
+	if conf.SegmentSize <= 0 {
+		conf.SegmentSize = 16 << 20
+	}
+	if conf.MaxBytes <= 0 {
+		conf.MaxBytes = 1 << 30
+	}
+	if conf.SegmentSize > conf.MaxBytes {
+		conf.SegmentSize = conf.MaxBytes
+	}
+	conf.Batch = conf.Batch.withDefaults()
+
+	q := &DurableQueue{conf: conf}
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+	if err := q.recover(); err != nil {
+		q.cancel()
+		return nil, err
+	}
+
+	for _, c := range q.consumers {
+		q.wg.Add(1)
+		go q.consume(c)
+	}
+	if conf.Fsync == FsyncInterval {
+		q.wg.Add(1)
+		go q.syncLoop()
+	}
+	return q, nil
+}
+
+// Emit implements Sink. It appends the event to the head segment, syncing it
+// first under FsyncAlways, and wakes the consumers. The Request is not kept,
+// nor the Keys when they cannot be marshalled to JSON; Panic and
+// ServerError are kept as strings.
+func (q *DurableQueue) Emit(_ context.Context, param LogFormatterParams) {
+	rec, err := encodeDurableRecord(&param)
+	if err != nil {
+		q.handleError(err)
+		return
+	}
+
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	err = q.append(rec)
+	q.mu.Unlock()
+	if err != nil {
+		q.handleError(fmt.Errorf("durable queue: %w", err))
+		return
+	}
+
+	for _, c := range q.consumers {
+		select {
+		case c.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Backlog returns the number of bytes the sink name has not been delivered yet.
+func (q *DurableQueue) Backlog(name string) int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, c := range q.consumers {
+		if c.name == name {
+			return q.backlog(c)
+		}
+	}
+	return 0
+}
+
+// Size returns the number of bytes of the segments on disk.
+func (q *DurableQueue) Size() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size()
+}
+
+// Evicted returns the number of bytes evicted because the queue was full.
+func (q *DurableQueue) Evicted() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.evicted
+}
+
+// Handler returns a Hertz handler reporting, as JSON, the size of the
+// queue, the bytes evicted and the backlog of every sink.
+func (q *DurableQueue) Handler() app.HandlerFunc {
+	return func(c context.Context, ctx *app.RequestContext) {
+		q.mu.Lock()
+		backlog := make(map[string]int64, len(q.consumers))
+		for _, c := range q.consumers {
+			backlog[c.name] = q.backlog(c)
+		}
+		stats := map[string]any{
+			"segments":      len(q.segments),
+			"size_bytes":    q.size(),
+			"evicted_bytes": q.evicted,
+			"backlog_bytes": backlog,
+		}
+		q.mu.Unlock()
+		ctx.JSON(consts.StatusOK, stats)
+	}
+}
+
+// Close stops the consumers, interrupting the retries of their current
+// delivery, and syncs the head segment. Undelivered events are delivered
+// after a restart.
+func (q *DurableQueue) Close() error {
+	var err error
+	q.once.Do(func() {
+		q.mu.Lock()
+		q.closed = true
+		q.mu.Unlock()
+
+		q.cancel()
+		q.wg.Wait()
+
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if q.conf.Fsync != FsyncNever {
+			err = q.head.Sync()
+		}
+		if cerr := q.head.Close(); err == nil {
+			err = cerr
+		}
+	})
+	return err
+}
+
+// recover loads the segments and checkpoints of Dir.
+func (q *DurableQueue) recover() error {
+	if err := os.MkdirAll(q.conf.Dir, 0o755); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(q.conf.Dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(name, ".tmp") {
+			// a checkpoint whose writing was interrupted
+			_ = os.Remove(filepath.Join(q.conf.Dir, name))
+			continue
+		}
+		if !strings.HasSuffix(name, ".seg") {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, ".seg"), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		q.segments = append(q.segments, durableSegment{id: id, size: info.Size()})
+	}
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i].id < q.segments[j].id })
+
+	if len(q.segments) == 0 {
+		q.segments = append(q.segments, durableSegment{id: 1})
+	} else if err = q.truncateTail(); err != nil {
+		return err
+	}
+	last := q.segments[len(q.segments)-1]
+	if q.head, err = os.OpenFile(q.segmentPath(last.id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(q.conf.Sinks))
+	for name := range q.conf.Sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c := &durableConsumer{name: name, sink: q.conf.Sinks[name], wake: make(chan struct{}, 1)}
+		c.seg, c.off = q.loadCheckpoint(name)
+		q.consumers = append(q.consumers, c)
+	}
+	q.collect()
+	return nil
+}
+
+// truncateTail truncates the last segment after its last whole record.
+func (q *DurableQueue) truncateTail() error {
+	last := &q.segments[len(q.segments)-1]
+	f, err := os.Open(q.segmentPath(last.id))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(io.LimitReader(f, last.size))
+	var valid int64
+	for {
+		_, n, err := readDurableRecord(r, last.size-valid)
+		if err != nil {
+			break
+		}
+		valid += n
+	}
+	if valid == last.size {
+		return nil
+	}
+	last.size = valid
+	return os.Truncate(q.segmentPath(last.id), valid)
+}
+
+// loadCheckpoint returns the position of the sink name, clamped to the
+// segments on disk.
+func (q *DurableQueue) loadCheckpoint(name string) (uint64, int64) {
+	first, last := q.segments[0], q.segments[len(q.segments)-1]
+
+	b, err := os.ReadFile(q.checkpointPath(name))
+	if err != nil {
+		return first.id, 0
+	}
+	var seg uint64
+	var off int64
+	if _, err = fmt.Sscan(string(b), &seg, &off); err != nil {
+		q.handleError(fmt.Errorf("durable queue: checkpoint of %s: %w", name, err))
+		return first.id, 0
+	}
+	switch {
+	case seg < first.id:
+		return first.id, 0
+	case seg > last.id:
+		return last.id, last.size
+	}
+	for _, s := range q.segments {
+		if s.id >= seg {
+			if s.id > seg || off < 0 {
+				return s.id, 0
+			}
+			if off > s.size {
+				off = s.size
+			}
+			return s.id, off
+		}
+	}
+	return last.id, last.size
+}
+
+// saveCheckpoint writes the position of c, replacing the previous one atomically.
+func (q *DurableQueue) saveCheckpoint(name string, seg uint64, off int64) error {
+	path := q.checkpointPath(name)
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(f, "%d %d\n", seg, off)
+	if err == nil && q.conf.Fsync != FsyncNever {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(path + ".tmp")
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// append writes rec to the head segment, rolling it over when full, and
+// evicts the oldest segments past MaxBytes.
+func (q *DurableQueue) append(rec []byte) error {
+	head := &q.segments[len(q.segments)-1]
+	if head.size > 0 && head.size+int64(len(rec)) > q.conf.SegmentSize {
+		if err := q.roll(); err != nil {
+			return err
+		}
+		head = &q.segments[len(q.segments)-1]
+	}
+
+	n, err := q.head.Write(rec)
+	if err != nil {
+		// drop the partial record, so that the segment stays readable
+		_ = q.head.Truncate(head.size)
+		return err
+	}
+	head.size += int64(n)
+	if q.conf.Fsync == FsyncAlways {
+		if err = q.head.Sync(); err != nil {
+			return err
+		}
+	} else {
+		q.dirty = true
+	}
+
+	q.evict()
+	return nil
+}
+
+// roll closes the head segment and starts a new one.
+func (q *DurableQueue) roll() error {
+	if q.conf.Fsync != FsyncNever {
+		if err := q.head.Sync(); err != nil {
+			return err
+		}
+	}
+	id := q.segments[len(q.segments)-1].id + 1
+	f, err := os.OpenFile(q.segmentPath(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	_ = q.head.Close()
+	q.head = f
+	q.dirty = false
+	q.segments = append(q.segments, durableSegment{id: id})
+	return nil
+}
+
+// evict removes the oldest segments while the queue is over MaxBytes,
+// moving the consumers still reading them to the next segment.
+func (q *DurableQueue) evict() {
+	for len(q.segments) > 1 && q.size() > q.conf.MaxBytes {
+		s := q.segments[0]
+		q.segments = q.segments[1:]
+		q.evicted += s.size
+		for _, c := range q.consumers {
+			if c.seg == s.id {
+				c.seg, c.off = q.segments[0].id, 0
+			}
+		}
+		if err := os.Remove(q.segmentPath(s.id)); err != nil {
+			q.handleError(fmt.Errorf("durable queue: %w", err))
+		}
+		q.handleError(fmt.Errorf("durable queue: evicted segment %d of %d bytes", s.id, s.size))
+	}
+}
+
+// collect removes the segments every consumer has read.
+func (q *DurableQueue) collect() {
+	oldest := q.consumers[0].seg
+	for _, c := range q.consumers[1:] {
+		if c.seg < oldest {
+			oldest = c.seg
+		}
+	}
+	for len(q.segments) > 1 && q.segments[0].id < oldest {
+		if err := os.Remove(q.segmentPath(q.segments[0].id)); err != nil && !os.IsNotExist(err) {
+			q.handleError(fmt.Errorf("durable queue: %w", err))
+		}
+		q.segments = q.segments[1:]
+	}
+}
+
+func (q *DurableQueue) size() int64 {
+	var n int64
+	for _, s := range q.segments {
+		n += s.size
+	}
+	return n
+}
+
+func (q *DurableQueue) backlog(c *durableConsumer) int64 {
+	var n int64
+	for _, s := range q.segments {
+		if s.id >= c.seg {
+			n += s.size
+		}
+	}
+	return n - c.off
+}
+
+func (q *DurableQueue) syncLoop() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.conf.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			q.mu.Lock()
+			if q.dirty {
+				q.dirty = false
+				if err := q.head.Sync(); err != nil {
+					q.handleError(fmt.Errorf("durable queue: %w", err))
+				}
+			}
+			q.mu.Unlock()
+		case <-q.ctx.Done():
+			return
+		}
+	}
+}
+
+// consume delivers the queue to c until the queue is closed.
+func (q *DurableQueue) consume(c *durableConsumer) {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case <-q.ctx.Done():
+			return
+		default:
+		}
+
+		seg, off, params, next, nextOff, err := q.read(c)
+		if err != nil {
+			q.handleError(fmt.Errorf("durable queue: %s: %w", c.name, err))
+		}
+		if len(params) > 0 && !q.deliver(c, params) {
+			return
+		}
+		if next == seg && nextOff == off {
+			select {
+			case <-c.wake:
+			case <-q.ctx.Done():
+				return
+			}
+			continue
+		}
+		q.commit(c, seg, off, next, nextOff)
+	}
+}
+
+// read returns the events of c from its position, up to Batch.MaxSize, and
+// the position following them. A corrupted record skips the rest of its
+// segment.
+func (q *DurableQueue) read(c *durableConsumer) (seg uint64, off int64, params []LogFormatterParams, next uint64, nextOff int64, err error) {
+	q.mu.Lock()
+	seg, off = c.seg, c.off
+	next, nextOff = seg, off
+	var limit int64
+	following := seg
+	for i, s := range q.segments {
+		if s.id == seg {
+			limit = s.size
+			if i+1 < len(q.segments) {
+				following = q.segments[i+1].id
+			}
+			break
+		}
+	}
+	q.mu.Unlock()
+
+	if off >= limit {
+		if following != seg {
+			next, nextOff = following, 0
+		}
+		return
+	}
+
+	f, err := os.Open(q.segmentPath(seg))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(io.NewSectionReader(f, off, limit-off))
+	for len(params) < q.conf.Batch.MaxSize && nextOff < limit {
+		var payload []byte
+		var n int64
+		payload, n, err = readDurableRecord(r, limit-nextOff)
+		if err == nil {
+			var param LogFormatterParams
+			if param, err = decodeDurableRecord(payload); err == nil {
+				params = append(params, param)
+			}
+		}
+		if err != nil {
+			err = fmt.Errorf("segment %d at %d: %w", seg, nextOff, err)
+			nextOff = limit
+			break
+		}
+		nextOff += n
+	}
+	return
+}
+
+// deliver hands params to the sink of c, retrying a failed BatchSink until
+// it succeeds. A batch the sink rejects for good is reported and skipped.
+// It returns false when the queue is closed first.
+func (q *DurableQueue) deliver(c *durableConsumer, params []LogFormatterParams) bool {
+	bs, ok := c.sink.(BatchSink)
+	if !ok {
+		for _, param := range params {
+			c.sink.Emit(context.Background(), param)
+		}
+		return true
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := bs.EmitBatch(q.ctx, params)
+		if err == nil {
+			return true
+		}
+		var perm *permanentError
+		if errors.As(err, &perm) {
+			q.handleError(fmt.Errorf("durable queue: %s: dropped %d events: %w", c.name, len(params), err))
+			return true
+		}
+		q.handleError(fmt.Errorf("durable queue: %s: %w", c.name, err))
+
+		timer := time.NewTimer(q.conf.Batch.backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-q.ctx.Done():
+			timer.Stop()
+			return false
+		}
+	}
+}
+
+// commit moves c from seg and off to next and nextOff, unless an eviction
+// moved it meanwhile, saves its checkpoint and collects the segments read.
+func (q *DurableQueue) commit(c *durableConsumer, seg uint64, off int64, next uint64, nextOff int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if c.seg != seg || c.off != off {
+		return
+	}
+	c.seg, c.off = next, nextOff
+	if err := q.saveCheckpoint(c.name, next, nextOff); err != nil {
+		q.handleError(fmt.Errorf("durable queue: %s: %w", c.name, err))
+	}
+	if next != seg {
+		q.collect()
+	}
+}
+
+func (q *DurableQueue) segmentPath(id uint64) string {
+	return filepath.Join(q.conf.Dir, fmt.Sprintf("%020d.seg", id))
+}
+
+func (q *DurableQueue) checkpointPath(name string) string {
+	return filepath.Join(q.conf.Dir, name+".ckpt")
+}
+
+func (q *DurableQueue) handleError(err error) {
+	if q.conf.ErrorHandler != nil {
+		q.conf.ErrorHandler(err)
+	}
+}
+
+// encodeDurableRecord returns the record of param.
+func encodeDurableRecord(param *LogFormatterParams) ([]byte, error) {
+	rec := durableRecord{LogFormatterParams: *param}
+	rec.Request = nil
+	if param.Request != nil {
+		for _, k := range durableHeaders {
+			if v := param.Request.Header.Peek(k); len(v) > 0 {
+				if rec.Headers == nil {
+					rec.Headers = make(map[string]string, len(durableHeaders))
+				}
+				rec.Headers[k] = string(v)
+			}
+		}
+	}
+	if param.Panic != nil {
+		rec.Panic = fmt.Sprint(param.Panic)
+	}
+	if param.ServerError != nil {
+		rec.ServerError = param.ServerError.Error()
+	}
+
+	payload, err := json.Marshal(rec)
+	if err != nil && rec.Keys != nil {
+		rec.Keys = nil
+		payload, err = json.Marshal(rec)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, durableHeaderSize, durableHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(b, uint32(len(payload)))
+	binary.LittleEndian.PutUint32(b[4:], crc32.ChecksumIEEE(payload))
+	return append(b, payload...), nil
+}
+
+// decodeDurableRecord returns the event of payload.
+func decodeDurableRecord(payload []byte) (LogFormatterParams, error) {
+	var rec durableRecord
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return LogFormatterParams{}, err
+	}
+	param := rec.LogFormatterParams
+	if rec.Panic != "" {
+		param.Panic = rec.Panic
+	}
+	if rec.ServerError != "" {
+		param.ServerError = errors.New(rec.ServerError)
+	}
+	if len(rec.Headers) > 0 {
+		param.Request = &protocol.Request{}
+		for k, v := range rec.Headers {
+			param.Request.Header.Set(k, v)
+		}
+	}
+	return param, nil
+}
+
+// readDurableRecord reads a record of at most limit bytes from r, returning
+// its payload and size.
+func readDurableRecord(r *bufio.Reader, limit int64) ([]byte, int64, error) {
+	var header [durableHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, 0, err
+	}
+	n := int64(binary.LittleEndian.Uint32(header[:]))
+	if n > limit-durableHeaderSize {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:]) {
+		return nil, 0, errors.New("checksum mismatch")
+	}
+	return payload, durableHeaderSize + n, nil
+}
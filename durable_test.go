@@ -0,0 +1,267 @@
+package accessLog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// batchRecorder is a BatchSink recording the paths it accepts, failing while down.
+type batchRecorder struct {
+	down  atomic.Bool
+	mu    sync.Mutex
+	paths []string
+}
+
+func (r *batchRecorder) Emit(c context.Context, param LogFormatterParams) {
+	_ = r.EmitBatch(c, []LogFormatterParams{param})
+}
+
+func (r *batchRecorder) EmitBatch(_ context.Context, params []LogFormatterParams) error {
+	if r.down.Load() {
+		return errors.New("collector down")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, param := range params {
+		r.paths = append(r.paths, param.Path)
+	}
+	return nil
+}
+
+func (r *batchRecorder) Paths() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.paths...)
+}
+
+func TestDurableQueueDelivers(t *testing.T) {
+	dir := t.TempDir()
+	batch := &batchRecorder{}
+	var mu sync.Mutex
+	var plain []LogFormatterParams
+	q, err := NewDurableQueue(DurableQueueConfig{
+		Dir: dir,
+		Sinks: map[string]Sink{
+			"batch": batch,
+			"plain": SinkFunc(func(_ context.Context, param LogFormatterParams) {
+				mu.Lock()
+				plain = append(plain, param)
+				mu.Unlock()
+			}),
+		},
+		Fsync: FsyncAlways,
+		Batch: BatchConfig{MaxSize: 3},
+	})
+	assert.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		q.Emit(context.Background(), LogFormatterParams{
+			Path:        fmt.Sprintf("/%d", i),
+			StatusCode:  500,
+			Panic:       errors.New("boom"),
+			ServerError: errors.New("bad header"),
+			Keys:        map[string]any{"user": "alice", "ch": make(chan int)},
+		})
+	}
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(batch.Paths()) == 10 && len(plain) == 10
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.NoError(t, q.Close())
+
+	assert.Equal(t, "/0", batch.Paths()[0])
+	assert.Equal(t, "/9", batch.Paths()[9])
+	assert.Equal(t, "boom", plain[0].Panic)
+	assert.EqualError(t, plain[0].ServerError, "bad header")
+	assert.Equal(t, 500, plain[0].StatusCode)
+	// the keys cannot be marshalled because of the channel
+	assert.Nil(t, plain[0].Keys)
+	assert.Zero(t, q.Backlog("batch"))
+	assert.Zero(t, q.Backlog("plain"))
+	assert.FileExists(t, filepath.Join(dir, "batch.ckpt"))
+}
+
+func TestDurableQueueRecovers(t *testing.T) {
+	dir := t.TempDir()
+	batch := &batchRecorder{}
+	batch.down.Store(true)
+	var errs atomic.Int32
+	conf := DurableQueueConfig{
+		Dir:          dir,
+		Sinks:        map[string]Sink{"batch": batch},
+		Batch:        BatchConfig{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		ErrorHandler: func(error) { errs.Add(1) },
+	}
+	q, err := NewDurableQueue(conf)
+	assert.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		q.Emit(context.Background(), LogFormatterParams{Path: fmt.Sprintf("/%d", i)})
+	}
+	assert.Eventually(t, func() bool { return errs.Load() > 0 }, time.Second, time.Millisecond)
+	backlog := q.Backlog("batch")
+	assert.Equal(t, q.Size(), backlog)
+	assert.NoError(t, q.Close())
+
+	// a crash tore the last record
+	f, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("%020d.seg", 1)), os.O_WRONLY|os.O_APPEND, 0)
+	assert.NoError(t, err)
+	_, _ = f.Write([]byte{42, 0, 0, 0, 1, 2})
+	assert.NoError(t, f.Close())
+
+	batch.down.Store(false)
+	q, err = NewDurableQueue(conf)
+	assert.NoError(t, err)
+	assert.Equal(t, backlog, q.Size())
+	assert.Eventually(t, func() bool { return len(batch.Paths()) == 5 }, time.Second, 10*time.Millisecond)
+	q.Emit(context.Background(), LogFormatterParams{Path: "/5"})
+	assert.Eventually(t, func() bool { return len(batch.Paths()) == 6 }, time.Second, 10*time.Millisecond)
+	assert.NoError(t, q.Close())
+	assert.Equal(t, []string{"/0", "/1", "/2", "/3", "/4", "/5"}, batch.Paths())
+
+	// delivered events are not delivered again
+	q, err = NewDurableQueue(conf)
+	assert.NoError(t, err)
+	assert.Zero(t, q.Backlog("batch"))
+	assert.NoError(t, q.Close())
+	assert.Len(t, batch.Paths(), 6)
+}
+
+func TestDurableQueueEvicts(t *testing.T) {
+	dir := t.TempDir()
+	batch := &batchRecorder{}
+	batch.down.Store(true)
+	conf := DurableQueueConfig{
+		Dir:         dir,
+		Sinks:       map[string]Sink{"batch": batch},
+		Fsync:       FsyncNever,
+		SegmentSize: 1000,
+		MaxBytes:    3000,
+		Batch:       BatchConfig{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+	}
+	q, err := NewDurableQueue(conf)
+	assert.NoError(t, err)
+	for i := 0; i < 50; i++ {
+		q.Emit(context.Background(), LogFormatterParams{Path: fmt.Sprintf("/%d", i)})
+	}
+	assert.LessOrEqual(t, q.Size(), conf.MaxBytes)
+	assert.Positive(t, q.Evicted())
+	assert.Equal(t, q.Size(), q.Backlog("batch"))
+	assert.NoError(t, q.Close())
+
+	segments, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+	var onDisk int64
+	for _, name := range segments {
+		info, err := os.Stat(name)
+		assert.NoError(t, err)
+		onDisk += info.Size()
+	}
+	assert.Equal(t, q.Size(), onDisk)
+
+	batch.down.Store(false)
+	q, err = NewDurableQueue(conf)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		paths := batch.Paths()
+		return len(paths) > 0 && paths[len(paths)-1] == "/49"
+	}, time.Second, 10*time.Millisecond)
+	assert.NoError(t, q.Close())
+	// the oldest events were evicted
+	assert.NotEqual(t, "/0", batch.Paths()[0])
+	assert.Less(t, len(batch.Paths()), 50)
+}
+
+func TestDurableQueueSkipsRejectedBatches(t *testing.T) {
+	var mu sync.Mutex
+	var accepted []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var events []map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&events)
+		if events[0]["path"] == "/bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		accepted = append(accepted, events[0]["path"].(string))
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	webhook, err := NewWebhook(WebhookConfig{URL: srv.URL})
+	assert.NoError(t, err)
+	defer webhook.Close()
+	var rejected atomic.Int32
+	q, err := NewDurableQueue(DurableQueueConfig{
+		Dir:   t.TempDir(),
+		Sinks: map[string]Sink{"webhook": webhook},
+		Batch: BatchConfig{MaxSize: 1},
+		ErrorHandler: func(err error) {
+			rejected.Add(1)
+		},
+	})
+	assert.NoError(t, err)
+
+	// the batch answered 400 is dropped instead of blocking the next ones
+	for _, path := range []string{"/a", "/bad", "/b"} {
+		q.Emit(context.Background(), LogFormatterParams{Path: path})
+	}
+	assert.Eventually(t, func() bool { return q.Backlog("webhook") == 0 }, 2*time.Second, 10*time.Millisecond)
+	assert.NoError(t, q.Close())
+	assert.Equal(t, []string{"/a", "/b"}, accepted)
+	assert.Equal(t, int32(1), rejected.Load())
+}
+
+func TestDurableQueueRecord(t *testing.T) {
+	rec, err := encodeDurableRecord(&LogFormatterParams{Path: "/a", Latency: time.Second, Panic: 42})
+	assert.NoError(t, err)
+
+	payload, n, err := readDurableRecord(bufio.NewReader(bytes.NewReader(rec)), int64(len(rec)))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(rec)), n)
+	param, err := decodeDurableRecord(payload)
+	assert.NoError(t, err)
+	assert.Equal(t, "/a", param.Path)
+	assert.Equal(t, time.Second, param.Latency)
+	assert.Equal(t, "42", param.Panic)
+	assert.Nil(t, param.Request)
+
+	// the trace context and user agent survive, other headers do not
+	req := &protocol.Request{}
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("tracestate", "vendor=1")
+	req.Header.Set("User-Agent", "curl/8.0")
+	req.Header.Set("Authorization", "Bearer secret")
+	rec, err = encodeDurableRecord(&LogFormatterParams{Path: "/a", Request: req})
+	assert.NoError(t, err)
+	param, err = decodeDurableRecord(rec[durableHeaderSize:])
+	assert.NoError(t, err)
+	if assert.NotNil(t, param.Request) {
+		tp, ok := requestTraceParent(param.Request)
+		assert.True(t, ok)
+		assert.Equal(t, "00f067aa0ba902b7", fmt.Sprintf("%x", tp.spanID))
+		assert.Equal(t, "vendor=1", string(param.Request.Header.Peek("tracestate")))
+		assert.Equal(t, "curl/8.0", string(param.Request.Header.UserAgent()))
+		assert.Empty(t, param.Request.Header.Peek("Authorization"))
+	}
+
+	rec[len(rec)-1] ^= 0xff
+	_, _, err = readDurableRecord(bufio.NewReader(bytes.NewReader(rec)), int64(len(rec)))
+	assert.EqualError(t, err, "checksum mismatch")
+
+	_, err = NewDurableQueue(DurableQueueConfig{Dir: t.TempDir(), Sinks: map[string]Sink{"../x": &batchRecorder{}}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,122 @@
+package accessLog
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ecsVersion is the version of the Elastic Common Schema ECSLogFormatter follows.
+const ecsVersion = "8.11.0"
+
+// ECSLogFormatter formats events as JSON documents following the Elastic Common Schema.
+func ECSLogFormatter(param LogFormatterParams) string {
+	b, _ := json.Marshal(newECSDocument(&param))
+	return string(b) + "\n"
+}
+
+// newECSDocument returns the ECS document of param.
+func newECSDocument(param *LogFormatterParams) map[string]any {
+	ts := param.TimeStamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	path, query, _ := strings.Cut(param.Path, "?")
+
+	outcome := "success"
+	if param.Level() == hlog.LevelError {
+		outcome = "failure"
+	}
+	event := map[string]any{
+		"kind":     "event",
+		"category": []string{"web"},
+		"type":     []string{"access"},
+		"outcome":  outcome,
+		"duration": param.Latency.Nanoseconds(),
+	}
+	start := ts.Add(-param.Latency).UTC().Format(time.RFC3339Nano)
+	event["start"] = start
+	if !param.InFlight {
+		event["end"] = ts.UTC().Format(time.RFC3339Nano)
+	}
+
+	request := map[string]any{"method": param.Method}
+	if param.RequestBodySize >= 0 {
+		request["body"] = map[string]any{"bytes": param.RequestBodySize}
+	}
+	response := map[string]any{"body": map[string]any{"bytes": param.BodySize}}
+	if !param.InFlight {
+		response["status_code"] = param.StatusCode
+	}
+	http := map[string]any{"request": request, "response": response}
+	if v := strings.TrimPrefix(param.Proto, "HTTP/"); v != "" {
+		http["version"] = v
+	}
+
+	url := map[string]any{"original": param.Path, "path": path}
+	if query != "" {
+		url["query"] = query
+	}
+	if param.Scheme != "" {
+		url["scheme"] = param.Scheme
+	}
+	if param.Host != "" {
+		url["domain"] = param.Host
+	}
+
+	source := map[string]any{"ip": param.ClientIP}
+	if param.RemotePort != 0 && param.RemoteIP == param.ClientIP {
+		source["port"] = param.RemotePort
+	}
+
+	doc := map[string]any{
+		"@timestamp": start,
+		"ecs":        map[string]any{"version": ecsVersion},
+		"event":      event,
+		"http":       http,
+		"url":        url,
+		"source":     source,
+		"client":     map[string]any{"ip": param.ClientIP},
+		"log":        map[string]any{"level": lokiLevel(param.Level())},
+		"message":    param.Method + " " + param.Path + " " + strconv.Itoa(param.StatusCode),
+	}
+	if param.Route != "" {
+		doc["labels"] = map[string]any{"route": param.Route}
+	}
+	if param.TLSVersion != "" {
+		doc["tls"] = map[string]any{
+			"version":          strings.TrimPrefix(param.TLSVersion, "TLS "),
+			"version_protocol": "tls",
+			"cipher":           param.TLSCipherSuite,
+		}
+	}
+	if param.Request != nil {
+		if ua := param.Request.Header.UserAgent(); len(ua) > 0 {
+			doc["user_agent"] = map[string]any{"original": string(ua)}
+		}
+	}
+	if tp, ok := requestTraceParent(param.Request); ok {
+		doc["trace"] = map[string]any{"id": hex.EncodeToString(tp.traceID[:])}
+		doc["span"] = map[string]any{"id": hex.EncodeToString(tp.spanID[:])}
+	}
+
+	errMap := make(map[string]any)
+	if msg := strings.TrimSpace(param.ErrorMessage); msg != "" {
+		errMap["message"] = msg
+	}
+	if param.Panic != nil {
+		errMap["message"] = fmt.Sprint(param.Panic)
+		errMap["type"] = "panic"
+		if param.Stack != "" {
+			errMap["stack_trace"] = param.Stack
+		}
+	}
+	if len(errMap) > 0 {
+		doc["error"] = errMap
+	}
+	return doc
+}
@@ -0,0 +1,264 @@
+package accessLog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ElasticsearchConfig defines the config for Elasticsearch.
+type ElasticsearchConfig struct {
+	// Endpoint is the base URL of the cluster, the documents are posted to
+	// its _bulk API. Elasticsearch and OpenSearch are both supported.
+	// Optional. Default value is "http://localhost:9200".
+	Endpoint string
+
+	// IndexPrefix is the name of the indices, suffixed with the UTC date of
+	// the events.
+	// Optional. Default value is "hertz-access".
+	IndexPrefix string
+
+	// IndexDateLayout is the time layout of the date suffix.
+	// Optional. Default value is "2006.01.02", a daily index such as hertz-access-2024.05.01.
+	IndexDateLayout string
+
+	// Username and Password authenticate with basic auth.
+	// Optional. Default value is "".
+	Username string
+	Password string
+
+	// APIKey authenticates with an encoded API key.
+	// Optional. Default value is "".
+	APIKey string
+
+	// Headers are added to every bulk request.
+	// Optional. Default value is nil.
+	Headers map[string]string
+
+	// Output receives the NDJSON bulk bodies instead of the cluster, such as
+	// a file for an offline import with the _bulk API.
+	// Optional. Default value is nil, the bodies are posted to Endpoint.
+	Output io.Writer
+
+	// Timeout is the timeout of a bulk request.
+	// Optional. Default value is 10 seconds.
+	Timeout time.Duration
+
+	// Batch defines how documents are batched and how failed bulk requests
+	// and documents, rejected with 429 or 5xx, are retried.
+	Batch BatchConfig
+
+	// ErrorHandler is called with the errors of the documents dropped.
+	// Optional. Default value is nil, errors are dropped.
+	ErrorHandler func(err error)
+}
+
+// Elasticsearch is a Sink indexing access events as ECS documents through
+// the _bulk API, in date-based indices.
+type Elasticsearch struct {
+	conf    ElasticsearchConfig
+	client  *http.Client
+	header  http.Header
+	batcher *batcher[[]byte]
+}
+
+// NewElasticsearch instance an Elasticsearch with config.
+func NewElasticsearch(conf ElasticsearchConfig) *Elasticsearch {
+	if conf.Endpoint == "" {
+		conf.Endpoint = "http://localhost:9200"
+	}
+	conf.Endpoint = strings.TrimSuffix(conf.Endpoint, "/")
+	if conf.IndexPrefix == "" {
+		conf.IndexPrefix = "hertz-access"
+	}
+	if conf.IndexDateLayout == "" {
+		conf.IndexDateLayout = "2006.01.02"
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 10 * time.Second
+	}
+	conf.Batch = conf.Batch.withDefaults()
+
+	header := make(http.Header, len(conf.Headers)+2)
+	for k, v := range conf.Headers {
+		header.Set(k, v)
+	}
+	header.Set("Content-Type", "application/x-ndjson")
+	if conf.APIKey != "" {
+		header.Set("Authorization", "ApiKey "+conf.APIKey)
+	}
+
+	es := &Elasticsearch{conf: conf, client: &http.Client{Timeout: conf.Timeout}, header: header}
+	es.batcher = newSizedBatcher(conf.Batch, func(item []byte) int { return len(item) }, es.bulk)
+	return es
+}
+
+// Emit implements Sink. It queues the document without blocking, dropping it
+// when the queue is full.
+func (es *Elasticsearch) Emit(_ context.Context, param LogFormatterParams) {
+	item, err := es.item(&param)
+	if err != nil {
+		if es.conf.ErrorHandler != nil {
+			es.conf.ErrorHandler(err)
+		}
+		return
+	}
+	es.batcher.add(item)
+}
+
+// EmitBatch implements BatchSink, indexing params in one bulk request.
+// Documents rejected for good are reported to the ErrorHandler, not returned.
+func (es *Elasticsearch) EmitBatch(c context.Context, params []LogFormatterParams) error {
+	items := make([][]byte, 0, len(params))
+	for i := range params {
+		item, err := es.item(&params[i])
+		if err != nil {
+			return err
+		}
+		items = append(items, item)
+	}
+	return es.send(c, items)
+}
+
+// item returns the action and document lines of param.
+func (es *Elasticsearch) item(param *LogFormatterParams) ([]byte, error) {
+	ts := param.TimeStamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	action, _ := json.Marshal(map[string]any{
+		"create": map[string]string{"_index": es.conf.IndexPrefix + "-" + ts.UTC().Format(es.conf.IndexDateLayout)},
+	})
+	doc, err := json.Marshal(newECSDocument(param))
+	if err != nil {
+		return nil, err
+	}
+
+	item := make([]byte, 0, len(action)+len(doc)+2)
+	item = append(append(item, action...), '\n')
+	return append(append(item, doc...), '\n'), nil
+}
+
+// Dropped returns the number of documents dropped because the queue was full.
+func (es *Elasticsearch) Dropped() uint64 {
+	return es.batcher.dropped()
+}
+
+// Close indexes the queued documents and stops the sink.
+func (es *Elasticsearch) Close() error {
+	es.batcher.close()
+	return nil
+}
+
+func (es *Elasticsearch) bulk(c context.Context, items [][]byte) {
+	if err := es.send(c, items); err != nil && es.conf.ErrorHandler != nil {
+		es.conf.ErrorHandler(err)
+	}
+}
+
+// send sends items, the action and document line pairs, retrying the
+// documents rejected with a transient status.
+func (es *Elasticsearch) send(c context.Context, items [][]byte) error {
+	if es.conf.Output != nil {
+		_, err := es.conf.Output.Write(bytes.Join(items, nil))
+		return err
+	}
+
+	err := es.conf.Batch.retry(c, func() error {
+		var err error
+		items, err = es.post(items)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("elasticsearch: dropped %d documents: %w", len(items), err)
+	}
+	return nil
+}
+
+// bulkResponse is the part of a _bulk response reporting failed items.
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// post sends items, returning the ones to retry. Documents rejected for
+// good are reported and dropped.
+func (es *Elasticsearch) post(items [][]byte) ([][]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, es.conf.Endpoint+"/_bulk", bytes.NewReader(bytes.Join(items, nil)))
+	if err != nil {
+		return items, &permanentError{err}
+	}
+	for k, v := range es.header {
+		req.Header[k] = v
+	}
+	if es.conf.Username != "" {
+		req.SetBasicAuth(es.conf.Username, es.conf.Password)
+	}
+
+	resp, err := es.client.Do(req)
+	if err != nil {
+		return items, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return items, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if len(body) > 512 {
+			body = body[:512]
+		}
+		err = fmt.Errorf("%s: %s %q", req.URL, resp.Status, bytes.TrimSpace(body))
+		if !bulkRetryable(resp.StatusCode) {
+			return items, &permanentError{err}
+		}
+		if delay := retryAfter(resp.Header.Get("Retry-After")); delay > 0 {
+			return items, &retryAfterError{err: err, delay: delay}
+		}
+		return items, err
+	}
+
+	var br bulkResponse
+	if err = json.Unmarshal(body, &br); err != nil {
+		return items, &permanentError{fmt.Errorf("elasticsearch: decoding bulk response: %w", err)}
+	}
+	if !br.Errors {
+		return nil, nil
+	}
+
+	var retry [][]byte
+	var lastErr error
+	for i, item := range br.Items {
+		if i >= len(items) {
+			break
+		}
+		for _, result := range item {
+			if result.Status >= 200 && result.Status < 300 {
+				continue
+			}
+			lastErr = fmt.Errorf("elasticsearch: document rejected with %d: %s", result.Status, result.Error)
+			if bulkRetryable(result.Status) {
+				retry = append(retry, items[i])
+			} else if es.conf.ErrorHandler != nil {
+				es.conf.ErrorHandler(lastErr)
+			}
+		}
+	}
+	if len(retry) > 0 {
+		return retry, lastErr
+	}
+	return nil, nil
+}
+
+func bulkRetryable(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
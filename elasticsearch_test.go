@@ -0,0 +1,150 @@
+package accessLog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestECSLogFormatter(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	router := route.NewEngine(config.NewOptions([]config.Option{}))
+	router.Use(LoggerWithConfig(LoggerConfig{Formatter: ECSLogFormatter, Output: buffer}))
+	router.GET("/users/:id", func(c context.Context, ctx *app.RequestContext) {
+		ctx.String(200, "hello")
+	})
+
+	_ = ut.PerformRequest(router, "GET", "/users/1?a=b", nil,
+		ut.Header{Key: "User-Agent", Value: "test-agent"},
+		ut.Header{Key: "traceparent", Value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"})
+
+	assert.True(t, strings.HasSuffix(buffer.String(), "}\n"))
+	var doc map[string]any
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &doc))
+
+	get := func(path string) any {
+		var v any = doc
+		for _, k := range strings.Split(path, ".") {
+			v = v.(map[string]any)[k]
+		}
+		return v
+	}
+	assert.Equal(t, ecsVersion, get("ecs.version"))
+	assert.Equal(t, "GET", get("http.request.method"))
+	assert.Equal(t, float64(200), get("http.response.status_code"))
+	assert.Equal(t, float64(5), get("http.response.body.bytes"))
+	assert.Equal(t, "/users/1?a=b", get("url.original"))
+	assert.Equal(t, "/users/1", get("url.path"))
+	assert.Equal(t, "a=b", get("url.query"))
+	assert.Equal(t, "test-agent", get("user_agent.original"))
+	assert.Equal(t, "/users/:id", get("labels.route"))
+	assert.Equal(t, "success", get("event.outcome"))
+	assert.Greater(t, get("event.duration"), float64(0))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", get("trace.id"))
+	assert.Contains(t, doc, "@timestamp")
+	assert.Contains(t, get("source"), "ip")
+}
+
+// bulkStandIn answers bulk requests with the item statuses of its rounds.
+type bulkStandIn struct {
+	mu     sync.Mutex
+	bodies []string
+	auth   []string
+	rounds [][]int
+}
+
+func (b *bulkStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bodies = append(b.bodies, string(body))
+	b.auth = append(b.auth, r.Header.Get("Authorization"))
+
+	n := strings.Count(string(body), "\n") / 2
+	statuses := make([]int, n)
+	for i := range statuses {
+		statuses[i] = 201
+	}
+	if len(b.rounds) > 0 {
+		statuses = b.rounds[0]
+		b.rounds = b.rounds[1:]
+	}
+
+	resp := bulkResponse{}
+	for _, s := range statuses {
+		item := map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		}{"create": {Status: s}}
+		if s >= 300 {
+			resp.Errors = true
+			e := item["create"]
+			e.Error = json.RawMessage(`{"type":"rejected"}`)
+			item["create"] = e
+		}
+		resp.Items = append(resp.Items, item)
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func TestElasticsearchPartialFailure(t *testing.T) {
+	standIn := &bulkStandIn{rounds: [][]int{{201, 429, 400}}}
+	srv := httptest.NewServer(standIn)
+	defer srv.Close()
+
+	var errs []error
+	es := NewElasticsearch(ElasticsearchConfig{
+		Endpoint:     srv.URL + "/",
+		APIKey:       "key",
+		Batch:        BatchConfig{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+		ErrorHandler: func(err error) { errs = append(errs, err) },
+	})
+	for i, path := range []string{"/a", "/b", "/c"} {
+		es.Emit(context.Background(), LogFormatterParams{
+			TimeStamp:  time.Date(2024, 5, 1, 23, 0, i, 0, time.FixedZone("X", -2*3600)),
+			Method:     "GET",
+			Path:       path,
+			StatusCode: 200,
+		})
+	}
+	assert.NoError(t, es.Close())
+
+	assert.Len(t, standIn.bodies, 2)
+	assert.Equal(t, "ApiKey key", standIn.auth[0])
+
+	lines := strings.Split(strings.TrimSuffix(standIn.bodies[0], "\n"), "\n")
+	assert.Len(t, lines, 6)
+	assert.Equal(t, `{"create":{"_index":"hertz-access-2024.05.02"}}`, lines[0])
+
+	// only the document rejected with 429 is retried
+	lines = strings.Split(strings.TrimSuffix(standIn.bodies[1], "\n"), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[1], `"original":"/b"`)
+
+	assert.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "400")
+}
+
+func TestElasticsearchOutput(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	es := NewElasticsearch(ElasticsearchConfig{Output: buffer, IndexPrefix: "web", IndexDateLayout: "2006.01"})
+	es.Emit(context.Background(), LogFormatterParams{TimeStamp: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), StatusCode: 500})
+	assert.NoError(t, es.Close())
+
+	lines := strings.Split(strings.TrimSuffix(buffer.String(), "\n"), "\n")
+	assert.Len(t, lines, 2)
+	assert.Equal(t, `{"create":{"_index":"web-2024.05"}}`, lines[0])
+	assert.Contains(t, lines[1], `"outcome":"failure"`)
+}
@@ -0,0 +1,117 @@
+package accessLog
+
+import (
+	"fmt"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EventFilter selects access events. Its zero value matches every event.
+type EventFilter struct {
+	// MinStatus and MaxStatus bound the status code, inclusively. Zero means no bound.
+	MinStatus int
+	MaxStatus int
+	// Method is the HTTP method of the request, case-insensitive.
+	Method string
+	// PathPrefix is a prefix of the path the client requests.
+	PathPrefix string
+	// ClientIP is the client IP of the request.
+	ClientIP string
+	// MinLatency is the lowest latency of the request.
+	MinLatency time.Duration
+	// Since and Until bound the TimeStamp of the event. Zero means no bound.
+	Since time.Time
+	Until time.Time
+}
+
+// Match reports whether param is selected by f.
+func (f *EventFilter) Match(param *LogFormatterParams) bool {
+	switch {
+	case f.MinStatus != 0 && param.StatusCode < f.MinStatus,
+		f.MaxStatus != 0 && param.StatusCode > f.MaxStatus,
+		f.Method != "" && !strings.EqualFold(f.Method, param.Method),
+		f.PathPrefix != "" && !strings.HasPrefix(param.Path, f.PathPrefix),
+		f.ClientIP != "" && f.ClientIP != param.ClientIP,
+		param.Latency < f.MinLatency,
+		!f.Since.IsZero() && param.TimeStamp.Before(f.Since),
+		!f.Until.IsZero() && param.TimeStamp.After(f.Until):
+		return false
+	}
+	return true
+}
+
+// ParseEventFilter reads an EventFilter from query arguments:
+//
+//	status       a status code (404), a class (5xx) or a range (400-499)
+//	method       the HTTP method
+//	path_prefix  a prefix of the path
+//	client_ip    the client IP
+//	min_latency  a duration such as 250ms
+//	since, until an RFC 3339 time, or a duration such as 5m meaning that long ago
+func ParseEventFilter(args *protocol.Args) (EventFilter, error) {
+	var f EventFilter
+	var err error
+
+	if v := string(args.Peek("status")); v != "" {
+		if f.MinStatus, f.MaxStatus, err = parseStatusRange(v); err != nil {
+			return f, err
+		}
+	}
+
+	f.Method = string(args.Peek("method"))
+	f.PathPrefix = string(args.Peek("path_prefix"))
+	f.ClientIP = string(args.Peek("client_ip"))
+
+	if v := string(args.Peek("min_latency")); v != "" {
+		if f.MinLatency, err = time.ParseDuration(v); err != nil {
+			return f, fmt.Errorf("invalid min_latency: %w", err)
+		}
+	}
+
+	now := time.Now()
+	if v := string(args.Peek("since")); v != "" {
+		if f.Since, err = parseTimeBound(v, now); err != nil {
+			return f, fmt.Errorf("invalid since: %w", err)
+		}
+	}
+	if v := string(args.Peek("until")); v != "" {
+		if f.Until, err = parseTimeBound(v, now); err != nil {
+			return f, fmt.Errorf("invalid until: %w", err)
+		}
+	}
+
+	return f, nil
+}
+
+// parseStatusRange parses a status code, class or range into inclusive bounds.
+func parseStatusRange(v string) (min, max int, err error) {
+	if len(v) == 3 && strings.HasSuffix(strings.ToLower(v), "xx") {
+		class, err := strconv.Atoi(v[:1])
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid status: %q", v)
+		}
+		return class * 100, class*100 + 99, nil
+	}
+
+	lo, hi, isRange := strings.Cut(v, "-")
+	if min, err = strconv.Atoi(lo); err != nil {
+		return 0, 0, fmt.Errorf("invalid status: %q", v)
+	}
+	if !isRange {
+		return min, min, nil
+	}
+	if max, err = strconv.Atoi(hi); err != nil {
+		return 0, 0, fmt.Errorf("invalid status: %q", v)
+	}
+	return min, max, nil
+}
+
+// parseTimeBound parses an RFC 3339 time, or a duration counted back from now.
+func parseTimeBound(v string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
@@ -0,0 +1,70 @@
+package accessLog
+
+import (
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseEventFilter(t *testing.T) {
+	args := &protocol.Args{}
+	args.ParseBytes([]byte("status=5xx&method=post&path_prefix=/api&client_ip=1.2.3.4&min_latency=100ms&since=2018-12-07T09:00:00Z&until=1h"))
+
+	f, err := ParseEventFilter(args)
+	assert.NoError(t, err)
+	assert.Equal(t, 500, f.MinStatus)
+	assert.Equal(t, 599, f.MaxStatus)
+	assert.Equal(t, "post", f.Method)
+	assert.Equal(t, "/api", f.PathPrefix)
+	assert.Equal(t, "1.2.3.4", f.ClientIP)
+	assert.Equal(t, 100*time.Millisecond, f.MinLatency)
+	assert.Equal(t, time.Date(2018, 12, 7, 9, 0, 0, 0, time.UTC), f.Since)
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), f.Until, time.Second)
+
+	for v, want := range map[string][2]int{"404": {404, 404}, "400-499": {400, 499}, "2XX": {200, 299}} {
+		args.ParseBytes([]byte("status=" + v))
+		f, err = ParseEventFilter(args)
+		assert.NoError(t, err)
+		assert.Equal(t, want, [2]int{f.MinStatus, f.MaxStatus}, v)
+	}
+
+	for _, q := range []string{"status=abc", "status=4xy", "min_latency=fast", "since=yesterday"} {
+		args.ParseBytes([]byte(q))
+		_, err = ParseEventFilter(args)
+		assert.Error(t, err, q)
+	}
+}
+
+func TestEventFilterMatch(t *testing.T) {
+	ts := time.Unix(1544173902, 0)
+	param := LogFormatterParams{
+		TimeStamp:  ts,
+		StatusCode: 503,
+		Latency:    time.Second,
+		ClientIP:   "1.2.3.4",
+		Method:     "POST",
+		Path:       "/api/orders",
+	}
+
+	assert.True(t, (&EventFilter{}).Match(&param))
+	assert.True(t, (&EventFilter{
+		MinStatus:  500,
+		MaxStatus:  599,
+		Method:     "post",
+		PathPrefix: "/api",
+		ClientIP:   "1.2.3.4",
+		MinLatency: time.Second,
+		Since:      ts.Add(-time.Minute),
+		Until:      ts,
+	}).Match(&param))
+
+	assert.False(t, (&EventFilter{MaxStatus: 499}).Match(&param))
+	assert.False(t, (&EventFilter{MinStatus: 504}).Match(&param))
+	assert.False(t, (&EventFilter{Method: "GET"}).Match(&param))
+	assert.False(t, (&EventFilter{PathPrefix: "/admin"}).Match(&param))
+	assert.False(t, (&EventFilter{ClientIP: "5.6.7.8"}).Match(&param))
+	assert.False(t, (&EventFilter{MinLatency: 2 * time.Second}).Match(&param))
+	assert.False(t, (&EventFilter{Since: ts.Add(time.Second)}).Match(&param))
+	assert.False(t, (&EventFilter{Until: ts.Add(-time.Second)}).Match(&param))
+}
@@ -0,0 +1,200 @@
+package accessLog
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// FluentConfig defines the config for Fluent.
+type FluentConfig struct {
+	// Network is the transport to the Forward input, tcp or unix.
+	// Optional. Default value is "tcp".
+	Network string
+
+	// Addr is the address of the Forward input, a socket path for unix.
+	// Optional. Default value is "127.0.0.1:24224".
+	Addr string
+
+	// Tag is the tag of the events.
+	// Optional. Default value is "hertz.access".
+	Tag string
+
+	// RequireAck sends every batch with a chunk option and waits for its ack,
+	// resending it on failure for at-least-once delivery.
+	// Optional. Default value is false.
+	RequireAck bool
+
+	// Timeout is the timeout of dialing, writing and waiting for an ack.
+	// Optional. Default value is 5 seconds.
+	Timeout time.Duration
+
+	// Batch defines how events are batched and how failed sends are retried.
+	Batch BatchConfig
+
+	// ErrorHandler is called with the errors of the batches dropped.
+	// Optional. Default value is nil, errors are dropped.
+	ErrorHandler func(err error)
+}
+
+// Fluent is a Sink sending access events to Fluentd or Fluent Bit over the
+// Forward protocol, a batch of entries per message. The connection is
+// re-established with backoff when it breaks.
+type Fluent struct {
+	conf    FluentConfig
+	batcher *batcher[any]
+
+	// mu serializes the writes of the batcher and of EmitBatch.
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewFluent instance a Fluent with config. The connection is dialed on the first batch.
+func NewFluent(conf FluentConfig) *Fluent {
+	if conf.Network == "" {
+		conf.Network = "tcp"
+	}
+	if conf.Addr == "" {
+		conf.Addr = "127.0.0.1:24224"
+	}
+	if conf.Tag == "" {
+		conf.Tag = "hertz.access"
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 5 * time.Second
+	}
+	conf.Batch = conf.Batch.withDefaults()
+
+	f := &Fluent{conf: conf}
+	f.batcher = newBatcher(conf.Batch, f.send)
+	return f
+}
+
+// Emit implements Sink. It queues the entry without blocking, dropping it
+// when the queue is full.
+func (f *Fluent) Emit(_ context.Context, param LogFormatterParams) {
+	entry, err := fluentEntry(&param)
+	if err != nil {
+		if f.conf.ErrorHandler != nil {
+			f.conf.ErrorHandler(err)
+		}
+		return
+	}
+	f.batcher.add(entry)
+}
+
+// EmitBatch implements BatchSink, sending params as one message and waiting
+// for its ack, even without RequireAck.
+func (f *Fluent) EmitBatch(c context.Context, params []LogFormatterParams) error {
+	entries := make([]any, 0, len(params))
+	for i := range params {
+		entry, err := fluentEntry(&params[i])
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+	return f.deliver(c, entries, true)
+}
+
+// Dropped returns the number of entries dropped because the queue was full.
+func (f *Fluent) Dropped() uint64 {
+	return f.batcher.dropped()
+}
+
+// Close sends the queued entries and closes the connection.
+func (f *Fluent) Close() error {
+	f.batcher.close()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.conn != nil {
+		return f.conn.Close()
+	}
+	return nil
+}
+
+// fluentEntry returns the Forward entry of param, its time and record.
+func fluentEntry(param *LogFormatterParams) ([]any, error) {
+	record, err := jsonEventFields(param)
+	if err != nil {
+		return nil, err
+	}
+	delete(record, "time")
+
+	ts := param.TimeStamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	return []any{msgpackEventTime(ts), record}, nil
+}
+
+// send writes a batch of entries, dropping it when it cannot be delivered.
+func (f *Fluent) send(c context.Context, entries []any) {
+	err := f.deliver(c, entries, f.conf.RequireAck)
+	if err != nil && f.conf.ErrorHandler != nil {
+		f.conf.ErrorHandler(fmt.Errorf("fluent: dropped %d entries: %w", len(entries), err))
+	}
+}
+
+// deliver writes entries as one Forward mode message, retried with the same
+// chunk ID so that the receiver can discard duplicates.
+func (f *Fluent) deliver(c context.Context, entries []any, ack bool) error {
+	option := map[string]any{"size": len(entries)}
+	var chunk string
+	if ack {
+		var id [16]byte
+		_, _ = rand.Read(id[:])
+		chunk = base64.StdEncoding.EncodeToString(id[:])
+		option["chunk"] = chunk
+	}
+	msg := appendMsgpack(nil, []any{f.conf.Tag, entries, option})
+
+	return f.conf.Batch.retry(c, func() error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if err := f.write(msg, chunk); err != nil {
+			if f.conn != nil {
+				_ = f.conn.Close()
+				f.conn, f.reader = nil, nil
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// write writes msg, dialing first when disconnected, and waits for the ack
+// of chunk when it is not empty. f.mu is held.
+func (f *Fluent) write(msg []byte, chunk string) error {
+	if f.conn == nil {
+		conn, err := net.DialTimeout(f.conf.Network, f.conf.Addr, f.conf.Timeout)
+		if err != nil {
+			return err
+		}
+		f.conn, f.reader = conn, bufio.NewReader(conn)
+	}
+
+	_ = f.conn.SetWriteDeadline(time.Now().Add(f.conf.Timeout))
+	if _, err := f.conn.Write(msg); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+
+	_ = f.conn.SetReadDeadline(time.Now().Add(f.conf.Timeout))
+	resp, err := readMsgpack(f.reader)
+	if err != nil {
+		return fmt.Errorf("fluent: reading ack: %w", err)
+	}
+	if m, ok := resp.(map[string]any); !ok || m["ack"] != chunk {
+		return fmt.Errorf("fluent: unexpected ack %v", resp)
+	}
+	return nil
+}
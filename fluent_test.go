@@ -0,0 +1,162 @@
+package accessLog
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	v := map[string]any{
+		"nil":    nil,
+		"bool":   true,
+		"small":  int64(5),
+		"neg":    int64(-5),
+		"int8":   int64(-100),
+		"uint16": int64(60000),
+		"int64":  int64(-1 << 40),
+		"float":  1.5,
+		"number": json.Number("300"),
+		"str":    strings.Repeat("s", 300),
+		"bin":    []byte{1, 2, 3},
+		"array":  []any{int64(1), "a"},
+		"ext":    msgpackEventTime(time.Unix(1, 2)),
+	}
+	got, err := readMsgpack(bufio.NewReader(strings.NewReader(string(appendMsgpack(nil, v)))))
+	assert.NoError(t, err)
+
+	want := make(map[string]any, len(v))
+	for k, e := range v {
+		want[k] = e
+	}
+	want["number"] = int64(300)
+	assert.Equal(t, want, got)
+}
+
+// readForward reads a Forward mode message from r.
+func readForward(t *testing.T, r *bufio.Reader) (tag string, entries []any, option map[string]any) {
+	msg, err := readMsgpack(r)
+	if !assert.NoError(t, err) {
+		return "", nil, nil
+	}
+	a := msg.([]any)
+	return a[0].(string), a[1].([]any), a[2].(map[string]any)
+}
+
+func TestFluentAck(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	f := NewFluent(FluentConfig{
+		Addr:       l.Addr().String(),
+		Tag:        "web.access",
+		RequireAck: true,
+		Timeout:    200 * time.Millisecond,
+		Batch:      BatchConfig{FlushInterval: 10 * time.Millisecond, MinBackoff: 10 * time.Millisecond},
+	})
+	f.Emit(context.Background(), LogFormatterParams{TimeStamp: time.Unix(1700000000, 5), StatusCode: 200, Path: "/a"})
+	f.Emit(context.Background(), LogFormatterParams{TimeStamp: time.Unix(1700000001, 0), StatusCode: 404, Path: "/b"})
+
+	// the first connection never acks: the batch is resent on a new one
+	conn, err := l.Accept()
+	assert.NoError(t, err)
+	_, _, first := readForward(t, bufio.NewReader(conn))
+	conn.Close()
+
+	conn, err = l.Accept()
+	assert.NoError(t, err)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	tag, entries, option := readForward(t, r)
+	assert.Equal(t, first["chunk"], option["chunk"])
+	assert.Equal(t, int64(2), option["size"])
+	_, err = conn.Write(appendMsgpack(nil, map[string]any{"ack": option["chunk"]}))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "web.access", tag)
+	assert.Len(t, entries, 2)
+	entry := entries[0].([]any)
+	ts := entry[0].(msgpackExt)
+	assert.Equal(t, int8(0), ts.typ)
+	assert.Equal(t, uint32(1700000000), binary.BigEndian.Uint32(ts.data))
+	assert.Equal(t, uint32(5), binary.BigEndian.Uint32(ts.data[4:]))
+	record := entry[1].(map[string]any)
+	assert.Equal(t, int64(200), record["status"])
+	assert.Equal(t, "/a", record["path"])
+	assert.NotContains(t, record, "time")
+	assert.Equal(t, "/b", entries[1].([]any)[1].(map[string]any)["path"])
+
+	assert.NoError(t, f.Close())
+}
+
+func TestFluentUnix(t *testing.T) {
+	dir, err := os.MkdirTemp("", "fluent")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	addr := filepath.Join(dir, "forward.sock")
+
+	l, err := net.Listen("unix", addr)
+	assert.NoError(t, err)
+	defer l.Close()
+
+	f := NewFluent(FluentConfig{Network: "unix", Addr: addr})
+	f.Emit(context.Background(), LogFormatterParams{StatusCode: 500, Method: "POST"})
+	assert.NoError(t, f.Close())
+
+	conn, err := l.Accept()
+	assert.NoError(t, err)
+	defer conn.Close()
+	tag, entries, option := readForward(t, bufio.NewReader(conn))
+	assert.Equal(t, "hertz.access", tag)
+	assert.Len(t, entries, 1)
+	assert.NotContains(t, option, "chunk")
+	assert.Equal(t, "POST", entries[0].([]any)[1].(map[string]any)["method"])
+}
+
+func TestFluentEmitBatch(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	chunks := make(chan string, 2)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for ack := true; ; ack = false {
+			msg, err := readMsgpack(r)
+			if err != nil {
+				return
+			}
+			chunk, _ := msg.([]any)[2].(map[string]any)["chunk"].(string)
+			chunks <- chunk
+			if ack {
+				_, _ = conn.Write(appendMsgpack(nil, map[string]any{"ack": chunk}))
+			}
+		}
+	}()
+
+	// without RequireAck, a batch still waits for its ack
+	f := NewFluent(FluentConfig{Addr: l.Addr().String(), Timeout: 100 * time.Millisecond})
+	params := []LogFormatterParams{{StatusCode: 200, Path: "/a"}, {StatusCode: 200, Path: "/b"}}
+	assert.NoError(t, f.EmitBatch(context.Background(), params))
+	assert.NotEmpty(t, <-chunks)
+
+	// a batch never acked fails
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.Error(t, f.EmitBatch(ctx, params))
+	assert.NoError(t, f.Close())
+}
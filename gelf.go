@@ -0,0 +1,328 @@
+package accessLog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GELFCompression is the compression of GELF UDP messages.
+type GELFCompression string
+
+const (
+	// GELFUncompressed sends the messages as is.
+	GELFUncompressed GELFCompression = ""
+	// GELFGzip compresses the messages with gzip.
+	GELFGzip GELFCompression = "gzip"
+	// GELFZlib compresses the messages with zlib.
+	GELFZlib GELFCompression = "zlib"
+)
+
+// GELFConfig defines the config for GELF.
+type GELFConfig struct {
+	// Network is the transport to Graylog, udp or tcp.
+	// Optional. Default value is "udp".
+	Network string
+
+	// Addr is the address of the GELF input.
+	// Optional. Default value is "127.0.0.1:12201".
+	Addr string
+
+	// Host is the host field of the messages.
+	// Optional. Default value is os.Hostname().
+	Host string
+
+	// Compression compresses the UDP messages. TCP messages are never compressed.
+	// Optional. Default value is GELFUncompressed.
+	Compression GELFCompression
+
+	// ChunkSize is the maximum size of a UDP datagram. Larger messages are
+	// split in up to 128 chunks.
+	// Optional. Default value is 1420.
+	ChunkSize int
+
+	// Formatter builds the short_message, its first line. The whole text is
+	// the full_message when it spans several lines.
+	// Optional. Default value is the default log format.
+	Formatter LogFormatter
+
+	// Timeout is the timeout of dialing and writing.
+	// Optional. Default value is 5 seconds.
+	Timeout time.Duration
+
+	// Batch defines how messages are queued and how failed writes are retried.
+	Batch BatchConfig
+
+	// ErrorHandler is called with the errors of the messages dropped.
+	// Optional. Default value is nil, errors are dropped.
+	ErrorHandler func(err error)
+}
+
+// GELF is a Sink sending access events to Graylog as GELF 1.1 messages,
+// chunked over UDP or null-byte framed over TCP. The TCP connection is
+// re-established when it breaks.
+type GELF struct {
+	conf    GELFConfig
+	batcher *batcher[[]byte]
+
+	// mu serializes the writes of the batcher and of EmitBatch.
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+const (
+	gelfMaxChunks  = 128
+	gelfChunkHead  = 12
+	gelfChunkMagic = "\x1e\x0f"
+)
+
+// NewGELF instance a GELF with config. The connection is dialed on the first message.
+func NewGELF(conf GELFConfig) *GELF {
+	if conf.Network == "" {
+		conf.Network = "udp"
+	}
+	if conf.Addr == "" {
+		conf.Addr = "127.0.0.1:12201"
+	}
+	if conf.Host == "" {
+		conf.Host, _ = os.Hostname()
+	}
+	if conf.ChunkSize <= gelfChunkHead {
+		conf.ChunkSize = 1420
+	}
+	if conf.Formatter == nil {
+		conf.Formatter = defaultLogFormatter
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 5 * time.Second
+	}
+	conf.Batch = conf.Batch.withDefaults()
+
+	g := &GELF{conf: conf}
+	g.batcher = newBatcher(conf.Batch, g.send)
+	return g
+}
+
+// Emit implements Sink. It queues the message without blocking, dropping it
+// when the queue is full.
+func (g *GELF) Emit(_ context.Context, param LogFormatterParams) {
+	msg, err := g.encode(&param)
+	if err != nil {
+		if g.conf.ErrorHandler != nil {
+			g.conf.ErrorHandler(err)
+		}
+		return
+	}
+	g.batcher.add(msg)
+}
+
+// EmitBatch implements BatchSink, writing the messages of params in order.
+// Over TCP, a batch is accepted once written to the connection; over UDP,
+// delivery is not confirmed and messages may still be lost.
+func (g *GELF) EmitBatch(c context.Context, params []LogFormatterParams) error {
+	msgs := make([][]byte, 0, len(params))
+	for i := range params {
+		msg, err := g.encode(&params[i])
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, msg)
+	}
+	return g.deliver(c, msgs)
+}
+
+// Dropped returns the number of messages dropped because the queue was full.
+func (g *GELF) Dropped() uint64 {
+	return g.batcher.dropped()
+}
+
+// Close sends the queued messages and closes the connection.
+func (g *GELF) Close() error {
+	g.batcher.close()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.conn != nil {
+		return g.conn.Close()
+	}
+	return nil
+}
+
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// encode returns the GELF message of param, compressed for UDP.
+func (g *GELF) encode(param *LogFormatterParams) ([]byte, error) {
+	text := strings.TrimSpace(ansiEscape.ReplaceAllString(g.conf.Formatter(*param), ""))
+	short, _, multiline := strings.Cut(text, "\n")
+
+	// the additional fields are the JSON event fields, prefixed with _
+	fields, err := jsonEventFields(param)
+	if err != nil {
+		return nil, err
+	}
+	delete(fields, "time")
+
+	msg := make(map[string]any, len(fields)+6)
+	for k, v := range fields {
+		msg["_"+k] = v
+	}
+	ts := param.TimeStamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	msg["version"] = "1.1"
+	msg["host"] = g.conf.Host
+	msg["short_message"] = short
+	msg["timestamp"] = float64(ts.UnixMilli()) / 1e3
+	msg["level"] = gelfLevel(param.Level())
+	if multiline {
+		msg["full_message"] = text
+	}
+
+	b, err := json.Marshal(msg)
+	if err != nil || g.conf.Network != "udp" {
+		return b, err
+	}
+	return gelfCompress(b, g.conf.Compression)
+}
+
+// gelfLevel returns the syslog severity of level.
+func gelfLevel(level hlog.Level) int {
+	switch level {
+	case hlog.LevelError:
+		return 3
+	case hlog.LevelWarn:
+		return 4
+	default:
+		return 6
+	}
+}
+
+func gelfCompress(b []byte, compression GELFCompression) ([]byte, error) {
+	var buf bytes.Buffer
+	switch compression {
+	case GELFGzip:
+		w := gzip.NewWriter(&buf)
+		_, _ = w.Write(b)
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	case GELFZlib:
+		w := zlib.NewWriter(&buf)
+		_, _ = w.Write(b)
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return b, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// send writes msgs, dropping the ones that cannot be delivered.
+func (g *GELF) send(c context.Context, msgs [][]byte) {
+	if err := g.deliver(c, msgs); err != nil && g.conf.ErrorHandler != nil {
+		g.conf.ErrorHandler(err)
+	}
+}
+
+// deliver writes msgs, reconnecting and retrying from the first failed
+// message. Messages too large to be chunked are skipped.
+func (g *GELF) deliver(c context.Context, msgs [][]byte) error {
+	err := g.conf.Batch.retry(c, func() error {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		for len(msgs) > 0 {
+			if err := g.write(msgs[0]); err != nil {
+				var perm *permanentError
+				if errors.As(err, &perm) {
+					msgs = msgs[1:]
+					if g.conf.ErrorHandler != nil {
+						g.conf.ErrorHandler(err)
+					}
+					continue
+				}
+				if g.conn != nil {
+					_ = g.conn.Close()
+					g.conn = nil
+				}
+				return err
+			}
+			msgs = msgs[1:]
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("gelf: dropped %d messages: %w", len(msgs), err)
+	}
+	return nil
+}
+
+// write writes msg, dialing first when disconnected. g.mu is held.
+func (g *GELF) write(msg []byte) error {
+	if g.conn == nil {
+		conn, err := net.DialTimeout(g.conf.Network, g.conf.Addr, g.conf.Timeout)
+		if err != nil {
+			return err
+		}
+		g.conn = conn
+	}
+	_ = g.conn.SetWriteDeadline(time.Now().Add(g.conf.Timeout))
+
+	if g.conf.Network != "udp" {
+		_, err := g.conn.Write(append(msg, 0))
+		return err
+	}
+
+	if len(msg) <= g.conf.ChunkSize {
+		_, err := g.conn.Write(msg)
+		return err
+	}
+	chunks, err := gelfChunks(msg, g.conf.ChunkSize)
+	if err != nil {
+		return &permanentError{err}
+	}
+	for _, c := range chunks {
+		if _, err := g.conn.Write(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gelfChunks splits msg in chunks of at most size bytes, headers included.
+func gelfChunks(msg []byte, size int) ([][]byte, error) {
+	data := size - gelfChunkHead
+	count := (len(msg) + data - 1) / data
+	if count > gelfMaxChunks {
+		return nil, fmt.Errorf("gelf: message of %d bytes exceeds %d chunks", len(msg), gelfMaxChunks)
+	}
+
+	var id [8]byte
+	_, _ = rand.Read(id[:])
+
+	chunks := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * data
+		if end > len(msg) {
+			end = len(msg)
+		}
+		c := make([]byte, 0, gelfChunkHead+end-i*data)
+		c = append(c, gelfChunkMagic...)
+		c = append(c, id[:]...)
+		c = append(c, byte(i), byte(count))
+		chunks = append(chunks, append(c, msg[i*data:end]...))
+	}
+	return chunks, nil
+}
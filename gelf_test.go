@@ -0,0 +1,121 @@
+package accessLog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGELFUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer pc.Close()
+
+	g := NewGELF(GELFConfig{Addr: pc.LocalAddr().String(), Host: "web-1"})
+	g.Emit(context.Background(), LogFormatterParams{
+		TimeStamp:    time.UnixMilli(1700000000123),
+		StatusCode:   500,
+		Method:       "GET",
+		Path:         "/users/1",
+		Route:        "/users/:id",
+		ErrorMessage: "boom\n",
+	})
+	assert.NoError(t, g.Close())
+
+	packets := readPackets(t, pc)
+	assert.Len(t, packets, 1)
+
+	var msg map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(packets[0]), &msg))
+	assert.Equal(t, "1.1", msg["version"])
+	assert.Equal(t, "web-1", msg["host"])
+	assert.Equal(t, 1700000000.123, msg["timestamp"])
+	assert.Equal(t, float64(3), msg["level"])
+	assert.True(t, strings.HasPrefix(msg["short_message"].(string), "[Hertz] "))
+	assert.NotContains(t, msg["short_message"], "boom")
+	assert.Contains(t, msg["full_message"], "boom")
+	assert.Equal(t, float64(500), msg["_status"])
+	assert.Equal(t, "/users/:id", msg["_route"])
+	assert.NotContains(t, msg, "_time")
+}
+
+func TestGELFUDPChunked(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer pc.Close()
+
+	g := NewGELF(GELFConfig{Addr: pc.LocalAddr().String(), Compression: GELFGzip, ChunkSize: 64})
+	g.Emit(context.Background(), LogFormatterParams{StatusCode: 200, Method: "GET", Path: "/" + strings.Repeat("a", 500)})
+	assert.NoError(t, g.Close())
+
+	packets := readPackets(t, pc)
+	assert.Greater(t, len(packets), 1)
+
+	var compressed []byte
+	for i, p := range packets {
+		assert.LessOrEqual(t, len(p), 64)
+		assert.Equal(t, gelfChunkMagic, p[:2])
+		assert.Equal(t, packets[0][2:10], p[2:10])
+		assert.Equal(t, byte(i), p[10])
+		assert.Equal(t, byte(len(packets)), p[11])
+		compressed = append(compressed, p[12:]...)
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	assert.NoError(t, err)
+	raw, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	var msg map[string]any
+	assert.NoError(t, json.Unmarshal(raw, &msg))
+	assert.Equal(t, "/"+strings.Repeat("a", 500), msg["_path"])
+
+	_, err = gelfChunks(make([]byte, 129*52), 64)
+	assert.Error(t, err)
+}
+
+func TestGELFTCPReconnect(t *testing.T) {
+	addr := freeAddr(t)
+
+	g := NewGELF(GELFConfig{
+		Network: "tcp",
+		Addr:    addr,
+		Batch:   BatchConfig{FlushInterval: 10 * time.Millisecond, MinBackoff: 20 * time.Millisecond, MaxBackoff: 50 * time.Millisecond, MaxRetries: 50},
+	})
+	g.Emit(context.Background(), LogFormatterParams{StatusCode: 200, Path: "/a"})
+	g.Emit(context.Background(), LogFormatterParams{StatusCode: 404, Path: "/b"})
+
+	// nothing listens yet: the first dials fail and are retried
+	time.Sleep(100 * time.Millisecond)
+	l, err := net.Listen("tcp", addr)
+	assert.NoError(t, err)
+	defer l.Close()
+
+	conn, err := l.Accept()
+	assert.NoError(t, err)
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	r := bufio.NewReader(conn)
+	for _, path := range []string{"/a", "/b"} {
+		frame, err := r.ReadBytes(0)
+		assert.NoError(t, err)
+		var msg map[string]any
+		assert.NoError(t, json.Unmarshal(frame[:len(frame)-1], &msg))
+		assert.Equal(t, path, msg["_path"])
+	}
+
+	// EmitBatch writes on the same connection
+	assert.NoError(t, g.EmitBatch(context.Background(), []LogFormatterParams{{StatusCode: 500, Path: "/c"}}))
+	frame, err := r.ReadBytes(0)
+	assert.NoError(t, err)
+	assert.Contains(t, string(frame), `"_path":"/c"`)
+	assert.NoError(t, g.Close())
+}
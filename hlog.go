@@ -0,0 +1,68 @@
+package accessLog
+
+import (
+	"context"
+	"fmt"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"strings"
+)
+
+// hlogLogFormatter is the log format function HlogSink uses by default.
+// hlog prints its own timestamp and level, so both are left out.
+var hlogLogFormatter = func(param LogFormatterParams) string {
+	line := fmt.Sprintf("[Hertz] %3d | %13v | %15s | %-7s %#v%s %s",
+		param.StatusCode,
+		param.Latency,
+		param.ClientIP,
+		param.Method,
+		param.Path,
+		protocolDetails(&param),
+		param.ErrorMessage,
+	)
+	if param.InFlight {
+		line += " still running"
+	}
+	if param.Panic != nil {
+		line += fmt.Sprintf(" panic: %v", param.Panic)
+	}
+	return line
+}
+
+// HlogSink reports access events through hlog, so they share the encoding,
+// destination and context hooks of the logger set with hlog.SetLogger.
+type HlogSink struct {
+	formatter LogFormatter
+}
+
+// NewHlogSink instance a HlogSink with the specified log format function.
+// Optional. Default value is hlogLogFormatter.
+func NewHlogSink(f LogFormatter) *HlogSink {
+	if f == nil {
+		f = hlogLogFormatter
+	}
+	return &HlogSink{formatter: f}
+}
+
+// Emit implements Sink. 5xx responses are logged with CtxErrorf, 4xx responses
+// with CtxWarnf and everything else with CtxInfof.
+func (s *HlogSink) Emit(c context.Context, param LogFormatterParams) {
+	msg := strings.TrimRight(s.formatter(param), "\n")
+
+	switch param.Level() {
+	case hlog.LevelError:
+		hlog.CtxErrorf(c, "%s", msg)
+	case hlog.LevelWarn:
+		hlog.CtxWarnf(c, "%s", msg)
+	default:
+		hlog.CtxInfof(c, "%s", msg)
+	}
+}
+
+// LoggerWithHlog instance a Logger middleware that reports access events through hlog.
+func LoggerWithHlog(notLogged ...string) app.HandlerFunc {
+	return LoggerWithConfig(LoggerConfig{
+		Sink:      NewHlogSink(nil),
+		SkipPaths: notLogged,
+	})
+}
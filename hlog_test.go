@@ -0,0 +1,61 @@
+package accessLog
+
+import (
+	"bytes"
+	"context"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestLoggerWithHlog(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	hlog.SetOutput(buffer)
+	defer hlog.SetOutput(os.Stderr)
+
+	router := route.NewEngine(config.NewOptions([]config.Option{}))
+	router.Use(LoggerWithHlog("/skipped"))
+	router.GET("/example", func(c context.Context, ctx *app.RequestContext) {})
+	router.GET("/fail", func(c context.Context, ctx *app.RequestContext) {
+		ctx.AbortWithStatus(500)
+	})
+	router.GET("/skipped", func(c context.Context, ctx *app.RequestContext) {})
+
+	_ = ut.PerformRequest(router, "GET", "/example?a=100", nil)
+	assert.Contains(t, buffer.String(), "[Info]")
+	assert.Contains(t, buffer.String(), "200")
+	assert.Contains(t, buffer.String(), "/example?a=100")
+	assert.NotContains(t, buffer.String(), "\n\n")
+
+	buffer.Reset()
+	_ = ut.PerformRequest(router, "GET", "/notfound", nil)
+	assert.Contains(t, buffer.String(), "[Warn]")
+	assert.Contains(t, buffer.String(), "404")
+
+	buffer.Reset()
+	_ = ut.PerformRequest(router, "GET", "/fail", nil)
+	assert.Contains(t, buffer.String(), "[Error]")
+	assert.Contains(t, buffer.String(), "500")
+
+	buffer.Reset()
+	_ = ut.PerformRequest(router, "GET", "/skipped", nil)
+	assert.Empty(t, buffer.String())
+}
+
+func TestHlogSinkWithFormatter(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	hlog.SetOutput(buffer)
+	defer hlog.SetOutput(os.Stderr)
+
+	sink := NewHlogSink(func(param LogFormatterParams) string {
+		return "[FORMATTER TEST] " + param.Method + " 100%\n"
+	})
+	sink.Emit(context.Background(), LogFormatterParams{Method: "GET", StatusCode: 200})
+
+	assert.Contains(t, buffer.String(), "[Info] [FORMATTER TEST] GET 100%\n")
+}
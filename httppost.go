@@ -0,0 +1,56 @@
+package accessLog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// postBatch POSTs body to url. Failed requests return a permanentError unless
+// retryable reports their status as transient; network errors are transient.
+func postBatch(client *http.Client, url string, header http.Header, body []byte, retryable func(code int) bool) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err}
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	err = fmt.Errorf("%s: %s %q", url, resp.Status, bytes.TrimSpace(msg))
+	if !retryable(resp.StatusCode) {
+		return &permanentError{err}
+	}
+	if delay := retryAfter(resp.Header.Get("Retry-After")); delay > 0 {
+		return &retryAfterError{err: err, delay: delay}
+	}
+	return err
+}
+
+// retryAfter parses a Retry-After header, in seconds or an HTTP date.
+func retryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(v); err == nil {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
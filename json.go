@@ -0,0 +1,91 @@
+package accessLog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// jsonEvent is the JSON representation of an access event.
+type jsonEvent struct {
+	Time                 time.Time     `json:"time"`
+	Status               int           `json:"status"`
+	Latency              time.Duration `json:"latency"`
+	ClientIP             string        `json:"client_ip"`
+	Method               string        `json:"method"`
+	Path                 string        `json:"path"`
+	Route                string        `json:"route,omitempty"`
+	Host                 string        `json:"host"`
+	Error                string        `json:"error,omitempty"`
+	BodySize             int           `json:"body_size"`
+	ContentLength        int           `json:"content_length"`
+	RequestBodySize      int           `json:"request_body_size"`
+	RequestContentLength int           `json:"request_content_length"`
+	Proto                string        `json:"proto,omitempty"`
+	Scheme               string        `json:"scheme,omitempty"`
+	TLSVersion           string        `json:"tls_version,omitempty"`
+	RemoteIP             string        `json:"remote_ip,omitempty"`
+	RemotePort           int           `json:"remote_port,omitempty"`
+	LocalAddr            string        `json:"local_addr,omitempty"`
+	Panic                string        `json:"panic,omitempty"`
+	Hijacked             bool          `json:"hijacked,omitempty"`
+	InFlight             bool          `json:"in_flight,omitempty"`
+	Slow                 bool          `json:"slow,omitempty"`
+}
+
+// newJSONEvent converts param into its JSON representation. Latency is in nanoseconds.
+func newJSONEvent(param *LogFormatterParams) jsonEvent {
+	e := jsonEvent{
+		Time:                 param.TimeStamp,
+		Status:               param.StatusCode,
+		Latency:              param.Latency,
+		ClientIP:             param.ClientIP,
+		Method:               param.Method,
+		Path:                 param.Path,
+		Route:                param.Route,
+		Host:                 param.Host,
+		Error:                param.ErrorMessage,
+		BodySize:             param.BodySize,
+		ContentLength:        param.ContentLength,
+		RequestBodySize:      param.RequestBodySize,
+		RequestContentLength: param.RequestContentLength,
+		Proto:                param.Proto,
+		Scheme:               param.Scheme,
+		TLSVersion:           param.TLSVersion,
+		RemoteIP:             param.RemoteIP,
+		RemotePort:           param.RemotePort,
+		LocalAddr:            param.LocalAddr,
+		Hijacked:             param.Hijacked,
+		InFlight:             param.InFlight,
+		Slow:                 param.Slow,
+	}
+	if param.Panic != nil {
+		e.Panic = fmt.Sprint(param.Panic)
+	}
+	return e
+}
+
+// JSONLogFormatter formats events as JSON objects, one per line. Latency is
+// in nanoseconds.
+func JSONLogFormatter(param LogFormatterParams) string {
+	b, _ := json.Marshal(newJSONEvent(&param))
+	return string(b) + "\n"
+}
+
+// jsonEventFields returns the fields of the JSON representation of param,
+// numbers as json.Number.
+func jsonEventFields(param *LogFormatterParams) (map[string]any, error) {
+	raw, err := json.Marshal(newJSONEvent(param))
+	if err != nil {
+		return nil, err
+	}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+
+	var fields map[string]any
+	if err = d.Decode(&fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
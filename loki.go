@@ -0,0 +1,319 @@
+package accessLog
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LokiEncoding is the payload encoding of a Loki push request.
+type LokiEncoding string
+
+const (
+	// LokiProtobuf encodes pushes as snappy compressed protobuf.
+	LokiProtobuf LokiEncoding = "protobuf"
+	// LokiJSON encodes pushes as JSON.
+	LokiJSON LokiEncoding = "json"
+)
+
+// LokiLabel is an event field usable as a Loki stream label.
+type LokiLabel string
+
+const (
+	// LokiLabelRoute is the route template, omitted when the request matched none.
+	LokiLabelRoute LokiLabel = "route"
+	// LokiLabelMethod is the HTTP method.
+	LokiLabelMethod LokiLabel = "method"
+	// LokiLabelStatus is the status class, such as 2xx.
+	LokiLabelStatus LokiLabel = "status"
+	// LokiLabelLevel is the level of the event: info, warn or error.
+	LokiLabelLevel LokiLabel = "level"
+)
+
+// LokiConfig defines the config for Loki.
+type LokiConfig struct {
+	// Endpoint is the URL of the push API.
+	// Optional. Default value is "http://localhost:3100/loki/api/v1/push".
+	Endpoint string
+
+	// Encoding is the payload encoding.
+	// Optional. Default value is LokiProtobuf.
+	Encoding LokiEncoding
+
+	// Service is the value of the service label.
+	// Optional. Default value is "", no service label.
+	Service string
+
+	// Labels are the event fields used as labels. They are bounded sets of
+	// values, keeping the number of streams low; the other fields go in the
+	// log line.
+	// Optional. Default value is route and status.
+	Labels []LokiLabel
+
+	// StaticLabels are added to every stream, such as env.
+	// Optional. Default value is nil.
+	StaticLabels map[string]string
+
+	// TenantID is sent as X-Scope-OrgID to a multi-tenant Loki.
+	// Optional. Default value is "".
+	TenantID string
+
+	// Headers are added to every push request, such as an Authorization.
+	// Optional. Default value is nil.
+	Headers map[string]string
+
+	// Formatter builds the log line.
+	// Optional. Default value is the JSON event.
+	Formatter LogFormatter
+
+	// Timeout is the timeout of a push request.
+	// Optional. Default value is 10 seconds.
+	Timeout time.Duration
+
+	// Batch defines how entries are batched and how failed pushes, answered
+	// 429 or 5xx, are retried.
+	Batch BatchConfig
+
+	// ErrorHandler is called with the errors of the batches dropped.
+	// Optional. Default value is nil, errors are dropped.
+	ErrorHandler func(err error)
+}
+
+// Loki is a Sink pushing access events to Grafana Loki.
+type Loki struct {
+	conf    LokiConfig
+	client  *http.Client
+	header  http.Header
+	batcher *batcher[lokiEntry]
+}
+
+// lokiEntry is a log line and the labels of its stream.
+type lokiEntry struct {
+	labels map[string]string
+	stream string
+	time   time.Time
+	line   string
+}
+
+// NewLoki instance a Loki with config.
+func NewLoki(conf LokiConfig) *Loki {
+	if conf.Endpoint == "" {
+		conf.Endpoint = "http://localhost:3100/loki/api/v1/push"
+	}
+	if conf.Encoding == "" {
+		conf.Encoding = LokiProtobuf
+	}
+	if conf.Labels == nil {
+		conf.Labels = []LokiLabel{LokiLabelRoute, LokiLabelStatus}
+	}
+	if conf.Formatter == nil {
+		conf.Formatter = JSONLogFormatter
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 10 * time.Second
+	}
+	conf.Batch = conf.Batch.withDefaults()
+
+	header := make(http.Header, len(conf.Headers)+3)
+	for k, v := range conf.Headers {
+		header.Set(k, v)
+	}
+	if conf.TenantID != "" {
+		header.Set("X-Scope-OrgID", conf.TenantID)
+	}
+	if conf.Encoding == LokiJSON {
+		header.Set("Content-Type", "application/json")
+	} else {
+		header.Set("Content-Type", "application/x-protobuf")
+		header.Set("Content-Encoding", "snappy")
+	}
+
+	l := &Loki{conf: conf, client: &http.Client{Timeout: conf.Timeout}, header: header}
+	l.batcher = newBatcher(conf.Batch, l.push)
+	return l
+}
+
+// Emit implements Sink. It queues the entry without blocking, dropping it
+// when the queue is full.
+func (l *Loki) Emit(_ context.Context, param LogFormatterParams) {
+	l.batcher.add(l.entry(&param))
+}
+
+// EmitBatch implements BatchSink, pushing params at once.
+func (l *Loki) EmitBatch(c context.Context, params []LogFormatterParams) error {
+	entries := make([]lokiEntry, 0, len(params))
+	for i := range params {
+		entries = append(entries, l.entry(&params[i]))
+	}
+	return l.send(c, entries)
+}
+
+func (l *Loki) entry(param *LogFormatterParams) lokiEntry {
+	labels := l.labels(param)
+	e := lokiEntry{
+		labels: labels,
+		stream: lokiStream(labels),
+		time:   param.TimeStamp,
+		line:   strings.TrimSuffix(l.conf.Formatter(*param), "\n"),
+	}
+	if e.time.IsZero() {
+		e.time = time.Now()
+	}
+	return e
+}
+
+// Dropped returns the number of entries dropped because the queue was full.
+func (l *Loki) Dropped() uint64 {
+	return l.batcher.dropped()
+}
+
+// Close pushes the queued entries and stops the sink.
+func (l *Loki) Close() error {
+	l.batcher.close()
+	return nil
+}
+
+// labels returns the labels of the stream of param.
+func (l *Loki) labels(param *LogFormatterParams) map[string]string {
+	labels := make(map[string]string, len(l.conf.StaticLabels)+len(l.conf.Labels)+1)
+	for k, v := range l.conf.StaticLabels {
+		labels[k] = v
+	}
+	if l.conf.Service != "" {
+		labels["service"] = l.conf.Service
+	}
+	for _, label := range l.conf.Labels {
+		var v string
+		switch label {
+		case LokiLabelRoute:
+			v = param.Route
+		case LokiLabelMethod:
+			v = param.Method
+		case LokiLabelStatus:
+			if !param.InFlight {
+				v = strconv.Itoa(param.StatusCode/100) + "xx"
+			}
+		case LokiLabelLevel:
+			v = lokiLevel(param.Level())
+		}
+		if v != "" {
+			labels[string(label)] = v
+		}
+	}
+	return labels
+}
+
+func lokiLevel(level hlog.Level) string {
+	switch level {
+	case hlog.LevelError:
+		return "error"
+	case hlog.LevelWarn:
+		return "warn"
+	default:
+		return "info"
+	}
+}
+
+// lokiStream returns the label set of labels, such as {route="/a", status="2xx"}.
+func lokiStream(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(quoteLabel(labels[k]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func (l *Loki) push(c context.Context, entries []lokiEntry) {
+	if err := l.send(c, entries); err != nil && l.conf.ErrorHandler != nil {
+		l.conf.ErrorHandler(err)
+	}
+}
+
+// send pushes entries grouped by stream, each stream ordered by time.
+func (l *Loki) send(c context.Context, entries []lokiEntry) error {
+	streams := make(map[string][]lokiEntry)
+	var order []string
+	for _, e := range entries {
+		if _, ok := streams[e.stream]; !ok {
+			order = append(order, e.stream)
+		}
+		streams[e.stream] = append(streams[e.stream], e)
+	}
+	for _, s := range streams {
+		sort.SliceStable(s, func(i, j int) bool { return s[i].time.Before(s[j].time) })
+	}
+
+	var body []byte
+	if l.conf.Encoding == LokiJSON {
+		body = encodeLokiJSON(order, streams)
+	} else {
+		body = snappyEncode(encodeLokiProto(order, streams))
+	}
+
+	return l.conf.Batch.retry(c, func() error {
+		return postBatch(l.client, l.conf.Endpoint, l.header, body, func(code int) bool {
+			return code == http.StatusTooManyRequests || code >= 500
+		})
+	})
+}
+
+// encodeLokiProto encodes a logproto.PushRequest.
+func encodeLokiProto(order []string, streams map[string][]lokiEntry) []byte {
+	var b []byte
+	for _, stream := range order {
+		b = appendMessageField(b, 1, func(b []byte) []byte { // streams
+			b = appendStringField(b, 1, stream)
+			for _, e := range streams[stream] {
+				b = appendMessageField(b, 2, func(b []byte) []byte { // entries
+					b = appendMessageField(b, 1, func(b []byte) []byte { // timestamp
+						b = appendVarintField(b, 1, uint64(e.time.Unix()))
+						return appendVarintField(b, 2, uint64(e.time.Nanosecond()))
+					})
+					return appendStringField(b, 2, e.line)
+				})
+			}
+			return b
+		})
+	}
+	return b
+}
+
+// encodeLokiJSON encodes a push request in JSON.
+func encodeLokiJSON(order []string, streams map[string][]lokiEntry) []byte {
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	payload := struct {
+		Streams []stream `json:"streams"`
+	}{Streams: make([]stream, 0, len(order))}
+
+	for _, key := range order {
+		s := stream{Stream: streams[key][0].labels}
+		for _, e := range streams[key] {
+			s.Values = append(s.Values, [2]string{strconv.FormatInt(e.time.UnixNano(), 10), e.line})
+		}
+		payload.Streams = append(payload.Streams, s)
+	}
+
+	body, _ := json.Marshal(payload)
+	return body
+}
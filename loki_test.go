@@ -0,0 +1,162 @@
+package accessLog
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// snappyDecode decodes the snappy block format.
+func snappyDecode(t *testing.T, src []byte) []byte {
+	n, l := binary.Uvarint(src)
+	src = src[l:]
+	dst := make([]byte, 0, n)
+	for len(src) > 0 {
+		tag := src[0]
+		switch tag & 3 {
+		case 0:
+			length := int(tag>>2) + 1
+			src = src[1:]
+			if length > 60 {
+				extra := length - 60
+				length = int(readUintLE(src[:extra])) + 1
+				src = src[extra:]
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+		case 1:
+			length := int(tag>>2&7) + 4
+			offset := int(tag>>5)<<8 | int(src[1])
+			for i := 0; i < length; i++ {
+				dst = append(dst, dst[len(dst)-offset])
+			}
+			src = src[2:]
+		case 2:
+			length := int(tag>>2) + 1
+			offset := int(binary.LittleEndian.Uint16(src[1:]))
+			for i := 0; i < length; i++ {
+				dst = append(dst, dst[len(dst)-offset])
+			}
+			src = src[3:]
+		default:
+			t.Fatal("unexpected copy with 4 byte offset")
+		}
+	}
+	assert.Equal(t, int(n), len(dst))
+	return dst
+}
+
+func readUintLE(b []byte) uint64 {
+	var u uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		u = u<<8 | uint64(b[i])
+	}
+	return u
+}
+
+func TestSnappyEncode(t *testing.T) {
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	for _, src := range [][]byte{
+		nil,
+		[]byte("abc"),
+		bytes.Repeat([]byte("hello loki "), 1000),
+		random,
+		append(bytes.Repeat([]byte{0}, 70000), random[:300]...),
+	} {
+		encoded := snappyEncode(src)
+		assert.Equal(t, string(src), string(snappyDecode(t, encoded)))
+	}
+	assert.Less(t, len(snappyEncode(bytes.Repeat([]byte("hello loki "), 1000))), 1000)
+}
+
+func TestLokiJSON(t *testing.T) {
+	collector := &otlpCollector{}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	loki := NewLoki(LokiConfig{
+		Endpoint:     srv.URL,
+		Encoding:     LokiJSON,
+		Service:      "shop",
+		Labels:       []LokiLabel{LokiLabelRoute, LokiLabelStatus, LokiLabelLevel},
+		StaticLabels: map[string]string{"env": "test"},
+		TenantID:     "team-a",
+	})
+
+	router := route.NewEngine(config.NewOptions([]config.Option{}))
+	router.Use(LoggerWithConfig(LoggerConfig{Sink: loki}))
+	router.GET("/users/:id", func(c context.Context, ctx *app.RequestContext) {})
+
+	_ = ut.PerformRequest(router, "GET", "/users/1", nil)
+	_ = ut.PerformRequest(router, "GET", "/users/2", nil)
+	_ = ut.PerformRequest(router, "GET", "/notfound", nil)
+	assert.NoError(t, loki.Close())
+
+	assert.Len(t, collector.bodies, 1)
+	assert.Equal(t, "team-a", collector.headers[0].Get("X-Scope-OrgID"))
+	assert.Equal(t, "application/json", collector.headers[0].Get("Content-Type"))
+
+	var payload struct {
+		Streams []struct {
+			Stream map[string]string
+			Values [][2]string
+		}
+	}
+	assert.NoError(t, json.Unmarshal(collector.bodies[0], &payload))
+	assert.Len(t, payload.Streams, 2)
+
+	assert.Equal(t, map[string]string{"env": "test", "service": "shop", "route": "/users/:id", "status": "2xx", "level": "info"}, payload.Streams[0].Stream)
+	assert.Len(t, payload.Streams[0].Values, 2)
+	var event map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(payload.Streams[0].Values[0][1]), &event))
+	assert.Equal(t, "/users/1", event["path"])
+
+	assert.Equal(t, map[string]string{"env": "test", "service": "shop", "status": "4xx", "level": "warn"}, payload.Streams[1].Stream)
+}
+
+func TestLokiProtobufRetry(t *testing.T) {
+	collector := &otlpCollector{statuses: []int{http.StatusTooManyRequests, http.StatusInternalServerError}}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	loki := NewLoki(LokiConfig{
+		Endpoint:  srv.URL,
+		Formatter: func(param LogFormatterParams) string { return param.Method + " " + param.Path + "\n" },
+		Batch:     BatchConfig{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+	})
+	loki.Emit(context.Background(), LogFormatterParams{TimeStamp: time.Unix(10, 5), Method: "GET", Path: "/b", Route: "/b", StatusCode: 200})
+	loki.Emit(context.Background(), LogFormatterParams{TimeStamp: time.Unix(9, 0), Method: "GET", Path: "/a", Route: "/b", StatusCode: 201})
+	assert.NoError(t, loki.Close())
+
+	assert.Len(t, collector.bodies, 3)
+	assert.Equal(t, "snappy", collector.headers[2].Get("Content-Encoding"))
+	assert.Equal(t, "application/x-protobuf", collector.headers[2].Get("Content-Type"))
+
+	req := protoFields(t, snappyDecode(t, collector.bodies[2]))
+	assert.Len(t, req[1], 1)
+	stream := protoFields(t, req[1][0].data)
+	assert.Equal(t, `{route="/b", status="2xx"}`, string(stream[1][0].data))
+	assert.Len(t, stream[2], 2)
+
+	// entries are ordered by time within the stream
+	first := protoFields(t, stream[2][0].data)
+	assert.Equal(t, "GET /a", string(first[2][0].data))
+	assert.Equal(t, uint64(9), protoFields(t, first[1][0].data)[1][0].n)
+	second := protoFields(t, stream[2][1].data)
+	ts := protoFields(t, second[1][0].data)
+	assert.Equal(t, uint64(10), ts[1][0].n)
+	assert.Equal(t, uint64(5), ts[2][0].n)
+}
@@ -0,0 +1,288 @@
+package accessLog
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLatencyBuckets are the default latency histogram buckets, in seconds.
+var DefaultLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// DefaultSizeBuckets are the default request and response size histogram buckets, in bytes.
+var DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1e6, 1e7}
+
+// MetricsConfig defines the config for Metrics.
+type MetricsConfig struct {
+	// Namespace prefixes the name of every metric.
+	// Optional. Default value is "http".
+	Namespace string
+
+	// LatencyBuckets are the upper bounds of the latency histogram, in seconds.
+	// Optional. Default value is DefaultLatencyBuckets.
+	LatencyBuckets []float64
+
+	// SizeBuckets are the upper bounds of the size histograms, in bytes.
+	// Optional. Default value is DefaultSizeBuckets.
+	SizeBuckets []float64
+
+	// Registry provides the in-flight requests gauge. Pass the Registry of the
+	// Logger middleware.
+	// Optional. Default value is nil, the gauge is not exposed.
+	Registry *Registry
+}
+
+// Metrics is a Sink deriving Prometheus metrics from access events: a request
+// counter by method, route and status class, latency and size histograms by
+// method and route, and an in-flight requests gauge.
+type Metrics struct {
+	conf MetricsConfig
+
+	mu       sync.Mutex
+	requests map[requestKey]uint64
+	latency  map[routeKey]*histogram
+	reqSize  map[routeKey]*histogram
+	respSize map[routeKey]*histogram
+}
+
+type routeKey struct {
+	method string
+	route  string
+}
+
+type requestKey struct {
+	routeKey
+	status string
+}
+
+// histogram counts observations in buckets.
+type histogram struct {
+	bounds []float64
+	counts []uint64 // counts[i] observations <= bounds[i], not cumulative; the last is +Inf
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	h.counts[sort.SearchFloat64s(h.bounds, v)]++
+	h.sum += v
+	h.count++
+}
+
+// NewMetrics instance a Metrics with config.
+func NewMetrics(conf MetricsConfig) *Metrics {
+	if conf.Namespace == "" {
+		conf.Namespace = "http"
+	}
+	if len(conf.LatencyBuckets) == 0 {
+		conf.LatencyBuckets = DefaultLatencyBuckets
+	}
+	if len(conf.SizeBuckets) == 0 {
+		conf.SizeBuckets = DefaultSizeBuckets
+	}
+	conf.LatencyBuckets = sortedBounds(conf.LatencyBuckets)
+	conf.SizeBuckets = sortedBounds(conf.SizeBuckets)
+
+	return &Metrics{
+		conf:     conf,
+		requests: make(map[requestKey]uint64),
+		latency:  make(map[routeKey]*histogram),
+		reqSize:  make(map[routeKey]*histogram),
+		respSize: make(map[routeKey]*histogram),
+	}
+}
+
+// sortedBounds returns a sorted copy of bounds without +Inf, the implicit
+// last bucket of every histogram.
+func sortedBounds(bounds []float64) []float64 {
+	sorted := make([]float64, 0, len(bounds))
+	for _, b := range bounds {
+		if !math.IsInf(b, +1) {
+			sorted = append(sorted, b)
+		}
+	}
+	sort.Float64s(sorted)
+	return sorted
+}
+
+// Emit implements Sink. Events of requests still running and the final
+// events of hijacked connections are not counted.
+func (m *Metrics) Emit(_ context.Context, param LogFormatterParams) {
+	if param.InFlight || param.Hijacked {
+		return
+	}
+
+	rk := routeKey{method: param.Method, route: param.Route}
+	status := strconv.Itoa(param.StatusCode/100) + "xx"
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{routeKey: rk, status: status}]++
+	m.histogram(m.latency, rk, m.conf.LatencyBuckets).observe(param.Latency.Seconds())
+	if size := requestSize(&param); size >= 0 {
+		m.histogram(m.reqSize, rk, m.conf.SizeBuckets).observe(float64(size))
+	}
+	m.histogram(m.respSize, rk, m.conf.SizeBuckets).observe(float64(param.BodySize))
+}
+
+func (m *Metrics) histogram(hs map[routeKey]*histogram, rk routeKey, bounds []float64) *histogram {
+	h, ok := hs[rk]
+	if !ok {
+		h = newHistogram(bounds)
+		hs[rk] = h
+	}
+	return h
+}
+
+// requestSize returns the size of the request body, -1 when it is unknown.
+func requestSize(param *LogFormatterParams) int {
+	if param.RequestBodySize >= 0 {
+		return param.RequestBodySize
+	}
+	return param.RequestContentLength
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	return m.write(w, false)
+}
+
+// Handler returns a Hertz handler serving the metrics in the Prometheus text
+// exposition format, or in OpenMetrics when the scraper accepts it.
+func (m *Metrics) Handler() app.HandlerFunc {
+	return func(c context.Context, ctx *app.RequestContext) {
+		openMetrics := strings.Contains(string(ctx.GetHeader("Accept")), "application/openmetrics-text")
+
+		var b strings.Builder
+		_, _ = m.write(&b, openMetrics)
+
+		contentType := "text/plain; version=0.0.4; charset=utf-8"
+		if openMetrics {
+			contentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+		}
+		ctx.Data(consts.StatusOK, contentType, []byte(b.String()))
+	}
+}
+
+func (m *Metrics) write(w io.Writer, openMetrics bool) (int64, error) {
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	ns := m.conf.Namespace
+
+	m.mu.Lock()
+	requestKeys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		requestKeys = append(requestKeys, k)
+	}
+	sort.Slice(requestKeys, func(i, j int) bool {
+		a, b := requestKeys[i], requestKeys[j]
+		if a.routeKey != b.routeKey {
+			return a.routeKey.less(b.routeKey)
+		}
+		return a.status < b.status
+	})
+
+	family := ns + "_requests_total"
+	if openMetrics {
+		family = ns + "_requests"
+	}
+	fmt.Fprintf(cw, "# HELP %s Total number of HTTP requests by method, route and status class.\n", family)
+	fmt.Fprintf(cw, "# TYPE %s counter\n", family)
+	for _, k := range requestKeys {
+		fmt.Fprintf(cw, "%s_requests_total{method=%s,route=%s,status=%s} %d\n",
+			ns, quoteLabel(k.method), quoteLabel(k.route), quoteLabel(k.status), m.requests[k])
+	}
+
+	writeHistograms(cw, ns+"_request_duration_seconds", "HTTP request latency in seconds by method and route.", m.latency)
+	writeHistograms(cw, ns+"_request_size_bytes", "HTTP request body size in bytes by method and route.", m.reqSize)
+	writeHistograms(cw, ns+"_response_size_bytes", "HTTP response body size in bytes by method and route.", m.respSize)
+	m.mu.Unlock()
+
+	if m.conf.Registry != nil {
+		fmt.Fprintf(cw, "# HELP %s_requests_in_flight Number of HTTP requests being processed.\n", ns)
+		fmt.Fprintf(cw, "# TYPE %s_requests_in_flight gauge\n", ns)
+		fmt.Fprintf(cw, "%s_requests_in_flight %d\n", ns, m.conf.Registry.Len())
+	}
+
+	if openMetrics {
+		fmt.Fprint(cw, "# EOF\n")
+	}
+
+	if cw.err == nil {
+		cw.err = cw.w.(*bufio.Writer).Flush()
+	}
+	return cw.n, cw.err
+}
+
+func (k routeKey) less(o routeKey) bool {
+	if k.route != o.route {
+		return k.route < o.route
+	}
+	return k.method < o.method
+}
+
+// writeHistograms writes a histogram family with one histogram per route key.
+func writeHistograms(w io.Writer, name, help string, hs map[routeKey]*histogram) {
+	keys := make([]routeKey, 0, len(hs))
+	for k := range hs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].less(keys[j]) })
+
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+	for _, k := range keys {
+		h := hs[k]
+		labels := fmt.Sprintf("method=%s,route=%s", quoteLabel(k.method), quoteLabel(k.route))
+
+		var cumulative uint64
+		for i, bound := range h.bounds {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(bound), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, h.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+	}
+}
+
+// quoteLabel quotes a label value, escaping backslashes, quotes and newlines.
+func quoteLabel(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v) + `"`
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, +1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countingWriter counts the bytes written and keeps the first error.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	w.err = err
+	return n, err
+}
@@ -0,0 +1,98 @@
+package accessLog
+
+import (
+	"context"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics(MetricsConfig{LatencyBuckets: []float64{1, 0.1}, SizeBuckets: []float64{10, 100}})
+
+	m.Emit(context.Background(), LogFormatterParams{
+		Method: "GET", Route: "/users/:id", StatusCode: 200, Latency: 50 * time.Millisecond,
+		BodySize: 42, RequestBodySize: 0,
+	})
+	m.Emit(context.Background(), LogFormatterParams{
+		Method: "GET", Route: "/users/:id", StatusCode: 204, Latency: 2 * time.Second,
+		BodySize: 0, RequestBodySize: -1, RequestContentLength: -1,
+	})
+	m.Emit(context.Background(), LogFormatterParams{
+		Method: "POST", Route: `/a"b`, StatusCode: 503, Latency: 500 * time.Millisecond,
+		BodySize: 500, RequestBodySize: -1, RequestContentLength: 20,
+	})
+	m.Emit(context.Background(), LogFormatterParams{Method: "GET", Route: "/users/:id", StatusCode: 200, InFlight: true})
+
+	var b strings.Builder
+	n, err := m.WriteTo(&b)
+	assert.NoError(t, err)
+	out := b.String()
+	assert.Equal(t, int64(len(out)), n)
+
+	assert.Contains(t, out, "# TYPE http_requests_total counter\n")
+	assert.Contains(t, out, `http_requests_total{method="GET",route="/users/:id",status="2xx"} 2`+"\n")
+	assert.Contains(t, out, `http_requests_total{method="POST",route="/a\"b",status="5xx"} 1`+"\n")
+
+	assert.Contains(t, out, "# TYPE http_request_duration_seconds histogram\n")
+	assert.Contains(t, out, `http_request_duration_seconds_bucket{method="GET",route="/users/:id",le="0.1"} 1`+"\n")
+	assert.Contains(t, out, `http_request_duration_seconds_bucket{method="GET",route="/users/:id",le="1"} 1`+"\n")
+	assert.Contains(t, out, `http_request_duration_seconds_bucket{method="GET",route="/users/:id",le="+Inf"} 2`+"\n")
+	assert.Contains(t, out, `http_request_duration_seconds_sum{method="GET",route="/users/:id"} 2.05`+"\n")
+	assert.Contains(t, out, `http_request_duration_seconds_count{method="GET",route="/users/:id"} 2`+"\n")
+
+	assert.Contains(t, out, `http_request_size_bytes_count{method="GET",route="/users/:id"} 1`+"\n")
+	assert.Contains(t, out, `http_request_size_bytes_sum{method="POST",route="/a\"b"} 20`+"\n")
+	assert.Contains(t, out, `http_response_size_bytes_bucket{method="GET",route="/users/:id",le="100"} 2`+"\n")
+	assert.Contains(t, out, `http_response_size_bytes_bucket{method="POST",route="/a\"b",le="100"} 0`+"\n")
+
+	assert.NotContains(t, out, "in_flight")
+	assert.NotContains(t, out, "# EOF")
+}
+
+func TestMetricsInfBucket(t *testing.T) {
+	m := NewMetrics(MetricsConfig{LatencyBuckets: []float64{math.Inf(+1), 1}})
+	m.Emit(context.Background(), LogFormatterParams{Method: "GET", Route: "/a", StatusCode: 200, Latency: 2 * time.Second})
+
+	var b strings.Builder
+	_, err := m.WriteTo(&b)
+	assert.NoError(t, err)
+	out := b.String()
+	assert.Equal(t, 1, strings.Count(out, `http_request_duration_seconds_bucket{method="GET",route="/a",le="+Inf"}`))
+	assert.Contains(t, out, `http_request_duration_seconds_bucket{method="GET",route="/a",le="1"} 0`+"\n")
+}
+
+func TestMetricsHandler(t *testing.T) {
+	registry := NewRegistry()
+	m := NewMetrics(MetricsConfig{Registry: registry})
+
+	router := route.NewEngine(config.NewOptions([]config.Option{}))
+	router.Use(LoggerWithConfig(LoggerConfig{Sink: m, Registry: registry, SkipPaths: []string{"/metrics"}}))
+	router.GET("/metrics", m.Handler())
+	router.GET("/users/:id", func(c context.Context, ctx *app.RequestContext) {})
+
+	_ = ut.PerformRequest(router, "GET", "/users/1", nil)
+	_ = ut.PerformRequest(router, "GET", "/users/2", nil)
+	_ = ut.PerformRequest(router, "GET", "/notfound", nil)
+
+	w := ut.PerformRequest(router, "GET", "/metrics", nil)
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+	body := w.Body.String()
+	assert.Contains(t, body, `http_requests_total{method="GET",route="/users/:id",status="2xx"} 2`+"\n")
+	assert.Contains(t, body, `http_requests_total{method="GET",route="",status="4xx"} 1`+"\n")
+	// the scrape itself is in flight
+	assert.Contains(t, body, "http_requests_in_flight 1\n")
+
+	w = ut.PerformRequest(router, "GET", "/metrics", nil, ut.Header{Key: "Accept", Value: "application/openmetrics-text; version=1.0.0"})
+	assert.Equal(t, "application/openmetrics-text; version=1.0.0; charset=utf-8", w.Header().Get("Content-Type"))
+	body = w.Body.String()
+	assert.Contains(t, body, "# TYPE http_requests counter\n")
+	assert.True(t, strings.HasSuffix(body, "# EOF\n"))
+}
@@ -0,0 +1,291 @@
+package accessLog
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+	"time"
+)
+
+// Minimal MessagePack encoding and decoding, enough for the Forward protocol
+// without depending on a msgpack library.
+
+// msgpackExt is an extension value.
+type msgpackExt struct {
+	typ  int8
+	data []byte
+}
+
+// appendMsgpack appends the encoding of v. Maps are encoded with sorted keys.
+func appendMsgpack(b []byte, v any) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0)
+	case bool:
+		if v {
+			return append(b, 0xc3)
+		}
+		return append(b, 0xc2)
+	case int:
+		return appendMsgpackInt(b, int64(v))
+	case int64:
+		return appendMsgpackInt(b, v)
+	case uint64:
+		if v <= math.MaxInt64 {
+			return appendMsgpackInt(b, int64(v))
+		}
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), v)
+	case float64:
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(v))
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return appendMsgpackInt(b, i)
+		}
+		f, _ := v.Float64()
+		return appendMsgpack(b, f)
+	case string:
+		return append(appendMsgpackHead(b, len(v), 0xa0, 32, 0xd9, 0xda, 0xdb), v...)
+	case []byte:
+		return append(appendMsgpackHead(b, len(v), 0, 0, 0xc4, 0xc5, 0xc6), v...)
+	case []any:
+		b = appendMsgpackHead(b, len(v), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, e := range v {
+			b = appendMsgpack(b, e)
+		}
+		return b
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b = appendMsgpackHead(b, len(v), 0x80, 16, 0, 0xde, 0xdf)
+		for _, k := range keys {
+			b = appendMsgpack(b, k)
+			b = appendMsgpack(b, v[k])
+		}
+		return b
+	case msgpackExt:
+		switch len(v.data) {
+		case 1, 2, 4, 8, 16:
+			b = append(b, 0xd4+byte(bits.TrailingZeros(uint(len(v.data)))), byte(v.typ))
+		default:
+			b = appendMsgpackHead(b, len(v.data), 0, 0, 0xc7, 0xc8, 0xc9)
+			b = append(b, byte(v.typ))
+		}
+		return append(b, v.data...)
+	default:
+		return appendMsgpack(b, fmt.Sprint(v))
+	}
+}
+
+func appendMsgpackInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0 && v < 128:
+		return append(b, byte(v))
+	case v < 0 && v >= -32:
+		return append(b, byte(v))
+	case v >= 0 && v <= math.MaxUint8:
+		return append(b, 0xcc, byte(v))
+	case v >= 0 && v <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(v))
+	case v >= 0 && v <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(v))
+	case v >= math.MinInt8 && v < 0:
+		return append(b, 0xd0, byte(v))
+	case v >= math.MinInt16 && v < 0:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(v))
+	case v >= math.MinInt32 && v < 0:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(v))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(v))
+	}
+}
+
+// appendMsgpackHead appends the header of a value of length n: the fix
+// format when n < fixMax, else the 8, 16 or 32 bit length format. A zero
+// code8 means the format has no 8 bit length.
+func appendMsgpackHead(b []byte, n int, fix byte, fixMax int, code8, code16, code32 byte) []byte {
+	switch {
+	case n < fixMax:
+		return append(b, fix|byte(n))
+	case code8 != 0 && n <= math.MaxUint8:
+		return append(b, code8, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, code16), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, code32), uint32(n))
+	}
+}
+
+// msgpackEventTime returns the Forward protocol EventTime extension of t.
+func msgpackEventTime(t time.Time) msgpackExt {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint32(data, uint32(t.Unix()))
+	binary.BigEndian.PutUint32(data[4:], uint32(t.Nanosecond()))
+	return msgpackExt{typ: 0, data: data}
+}
+
+var errMsgpackType = errors.New("msgpack: unsupported type")
+
+// readMsgpack decodes a value from r: nil, bool, int64, uint64 for the
+// integers beyond int64, float64, string, []byte, []any, map[string]any or
+// msgpackExt.
+func readMsgpack(r io.Reader) (any, error) {
+	var head [1]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, err
+	}
+	c := head[0]
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return readMsgpackMap(r, int(c&0x0f))
+	case c&0xf0 == 0x90:
+		return readMsgpackArray(r, int(c&0x0f))
+	case c&0xe0 == 0xa0:
+		b, err := readMsgpackBytes(r, int(c&0x1f))
+		return string(b), err
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := readMsgpackLen(r, c-0xc4)
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackBytes(r, n)
+	case 0xc7, 0xc8, 0xc9:
+		n, err := readMsgpackLen(r, c-0xc7)
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackExt(r, n)
+	case 0xca:
+		b, err := readMsgpackBytes(r, 4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case 0xcb:
+		b, err := readMsgpackBytes(r, 8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		b, err := readMsgpackBytes(r, 1<<(c-0xcc))
+		if err != nil {
+			return nil, err
+		}
+		u := readUint(b)
+		if u > math.MaxInt64 {
+			return u, nil
+		}
+		return int64(u), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		b, err := readMsgpackBytes(r, 1<<(c-0xd0))
+		if err != nil {
+			return nil, err
+		}
+		u := readUint(b)
+		shift := 64 - 8*len(b)
+		return int64(u<<shift) >> shift, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return readMsgpackExt(r, 1<<(c-0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := readMsgpackLen(r, c-0xd9)
+		if err != nil {
+			return nil, err
+		}
+		b, err := readMsgpackBytes(r, n)
+		return string(b), err
+	case 0xdc, 0xdd:
+		n, err := readMsgpackLen(r, c-0xdc+1)
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackArray(r, n)
+	case 0xde, 0xdf:
+		n, err := readMsgpackLen(r, c-0xde+1)
+		if err != nil {
+			return nil, err
+		}
+		return readMsgpackMap(r, n)
+	}
+	return nil, errMsgpackType
+}
+
+// readMsgpackLen reads a length of 1, 2 or 4 bytes for size 0, 1 or 2.
+func readMsgpackLen(r io.Reader, size byte) (int, error) {
+	b, err := readMsgpackBytes(r, 1<<size)
+	if err != nil {
+		return 0, err
+	}
+	return int(readUint(b)), nil
+}
+
+func readUint(b []byte) uint64 {
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u
+}
+
+func readMsgpackBytes(r io.Reader, n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := io.ReadFull(r, b)
+	return b, err
+}
+
+func readMsgpackExt(r io.Reader, n int) (any, error) {
+	b, err := readMsgpackBytes(r, n+1)
+	if err != nil {
+		return nil, err
+	}
+	return msgpackExt{typ: int8(b[0]), data: b[1:]}, nil
+}
+
+func readMsgpackArray(r io.Reader, n int) (any, error) {
+	a := make([]any, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := readMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+func readMsgpackMap(r io.Reader, n int) (any, error) {
+	m := make(map[string]any, n)
+	for i := 0; i < n; i++ {
+		k, err := readMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		v, err := readMsgpack(r)
+		if err != nil {
+			return nil, err
+		}
+		m[fmt.Sprint(k)] = v
+	}
+	return m, nil
+}
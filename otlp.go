@@ -0,0 +1,466 @@
+package accessLog
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTLPEncoding is the payload encoding of an OTLP/HTTP export.
+type OTLPEncoding string
+
+const (
+	// OTLPProtobuf encodes payloads as binary protobuf.
+	OTLPProtobuf OTLPEncoding = "protobuf"
+	// OTLPJSON encodes payloads as the protobuf JSON mapping.
+	OTLPJSON OTLPEncoding = "json"
+)
+
+// OTLPConfig defines the config for OTLPExporter.
+type OTLPConfig struct {
+	// Endpoint is the URL the logs are posted to.
+	// Optional. Default value is "http://localhost:4318/v1/logs".
+	Endpoint string
+
+	// Encoding is the payload encoding.
+	// Optional. Default value is OTLPProtobuf.
+	Encoding OTLPEncoding
+
+	// Headers are added to every export request, such as an API key.
+	// Optional. Default value is nil.
+	Headers map[string]string
+
+	// Resource are the attributes of the resource producing the logs.
+	// service.name defaults to unknown_service.
+	// Optional. Default value is nil.
+	Resource map[string]string
+
+	// Timeout is the timeout of an export request.
+	// Optional. Default value is 10 seconds.
+	Timeout time.Duration
+
+	// Batch defines how records are batched and retried.
+	Batch BatchConfig
+
+	// ErrorHandler is called with the errors of the batches dropped.
+	// Optional. Default value is nil, errors are dropped.
+	ErrorHandler func(err error)
+}
+
+// OTLPExporter is a Sink exporting access events as OpenTelemetry log
+// records over OTLP/HTTP, with the attributes of the HTTP semantic
+// conventions and the trace context of the traceparent header.
+type OTLPExporter struct {
+	conf     OTLPConfig
+	client   *http.Client
+	header   http.Header
+	resource []otlpAttr
+	batcher  *batcher[otlpRecord]
+}
+
+// otlpRecord is a log record ready to be encoded.
+type otlpRecord struct {
+	time     time.Time
+	observed time.Time
+	severity hlog.Level
+	body     string
+	attrs    []otlpAttr
+	trace    traceParent
+	hasTrace bool
+}
+
+// otlpAttr is an attribute with a string, int, double or bool value.
+type otlpAttr struct {
+	key  string
+	kind byte
+	s    string
+	i    int64
+	f    float64
+	b    bool
+}
+
+const (
+	otlpString = iota
+	otlpBool
+	otlpInt
+	otlpDouble
+)
+
+func stringAttr(k, v string) otlpAttr         { return otlpAttr{key: k, kind: otlpString, s: v} }
+func intAttr(k string, v int64) otlpAttr      { return otlpAttr{key: k, kind: otlpInt, i: v} }
+func doubleAttr(k string, v float64) otlpAttr { return otlpAttr{key: k, kind: otlpDouble, f: v} }
+func boolAttr(k string, v bool) otlpAttr      { return otlpAttr{key: k, kind: otlpBool, b: v} }
+
+// NewOTLPExporter instance an OTLPExporter with config.
+func NewOTLPExporter(conf OTLPConfig) *OTLPExporter {
+	if conf.Endpoint == "" {
+		conf.Endpoint = "http://localhost:4318/v1/logs"
+	}
+	if conf.Encoding == "" {
+		conf.Encoding = OTLPProtobuf
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 10 * time.Second
+	}
+	conf.Batch = conf.Batch.withDefaults()
+
+	e := &OTLPExporter{
+		conf:     conf,
+		client:   &http.Client{Timeout: conf.Timeout},
+		header:   otlpHeader(conf.Encoding, conf.Headers),
+		resource: otlpResource(conf.Resource),
+	}
+	e.batcher = newBatcher(conf.Batch, e.export)
+	return e
+}
+
+// otlpHeader returns the header of the export requests.
+func otlpHeader(encoding OTLPEncoding, headers map[string]string) http.Header {
+	header := make(http.Header, len(headers)+1)
+	for k, v := range headers {
+		header.Set(k, v)
+	}
+	if encoding == OTLPJSON {
+		header.Set("Content-Type", "application/json")
+	} else {
+		header.Set("Content-Type", "application/x-protobuf")
+	}
+	return header
+}
+
+// otlpResource returns the resource attributes, sorted by key.
+func otlpResource(resource map[string]string) []otlpAttr {
+	attrs := make([]otlpAttr, 0, len(resource)+1)
+	if _, ok := resource["service.name"]; !ok {
+		attrs = append(attrs, stringAttr("service.name", "unknown_service"))
+	}
+	for k, v := range resource {
+		attrs = append(attrs, stringAttr(k, v))
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].key < attrs[j].key })
+	return attrs
+}
+
+// Emit implements Sink. It queues the record without blocking, dropping it
+// when the queue is full.
+func (e *OTLPExporter) Emit(_ context.Context, param LogFormatterParams) {
+	e.batcher.add(newOTLPRecord(&param))
+}
+
+// Dropped returns the number of records dropped because the queue was full.
+func (e *OTLPExporter) Dropped() uint64 {
+	return e.batcher.dropped()
+}
+
+// Close exports the queued records and stops the exporter.
+func (e *OTLPExporter) Close() error {
+	e.batcher.close()
+	return nil
+}
+
+// EmitBatch implements BatchSink, exporting params at once.
+func (e *OTLPExporter) EmitBatch(c context.Context, params []LogFormatterParams) error {
+	records := make([]otlpRecord, 0, len(params))
+	for i := range params {
+		records = append(records, newOTLPRecord(&params[i]))
+	}
+	return e.send(c, records)
+}
+
+func (e *OTLPExporter) export(c context.Context, records []otlpRecord) {
+	if err := e.send(c, records); err != nil && e.conf.ErrorHandler != nil {
+		e.conf.ErrorHandler(err)
+	}
+}
+
+// send posts records, retrying as configured until c is done.
+func (e *OTLPExporter) send(c context.Context, records []otlpRecord) error {
+	var body []byte
+	if e.conf.Encoding == OTLPJSON {
+		body = encodeOTLPLogsJSON(e.resource, records)
+	} else {
+		body = encodeOTLPLogsProto(e.resource, records)
+	}
+
+	return e.conf.Batch.retry(c, func() error {
+		return postBatch(e.client, e.conf.Endpoint, e.header, body, otlpRetryable)
+	})
+}
+
+// otlpRetryable reports the statuses the OTLP specification allows to retry.
+func otlpRetryable(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// newOTLPRecord maps param to a log record following the HTTP semantic conventions.
+func newOTLPRecord(param *LogFormatterParams) otlpRecord {
+	r := otlpRecord{
+		time:     param.TimeStamp,
+		observed: time.Now(),
+		severity: param.Level(),
+		body:     param.Method + " " + param.Path + " " + strconv.Itoa(param.StatusCode),
+	}
+	if r.time.IsZero() {
+		r.time = r.observed
+	}
+	r.trace, r.hasTrace = requestTraceParent(param.Request)
+	r.attrs = httpAttrs(param)
+	return r
+}
+
+// httpAttrs returns the attributes of param following the HTTP semantic conventions.
+func httpAttrs(param *LogFormatterParams) []otlpAttr {
+	path, query, _ := strings.Cut(param.Path, "?")
+
+	attrs := []otlpAttr{
+		stringAttr("http.request.method", param.Method),
+		stringAttr("url.path", path),
+		stringAttr("client.address", param.ClientIP),
+		doubleAttr("http.server.request.duration", param.Latency.Seconds()),
+		intAttr("http.response.body.size", int64(param.BodySize)),
+	}
+	if !param.InFlight {
+		attrs = append(attrs, intAttr("http.response.status_code", int64(param.StatusCode)))
+	}
+	if query != "" {
+		attrs = append(attrs, stringAttr("url.query", query))
+	}
+	if param.Route != "" {
+		attrs = append(attrs, stringAttr("http.route", param.Route))
+	}
+	if param.Scheme != "" {
+		attrs = append(attrs, stringAttr("url.scheme", param.Scheme))
+	}
+	if param.Host != "" {
+		attrs = append(attrs, stringAttr("server.address", param.Host))
+	}
+	if param.RemotePort != 0 {
+		attrs = append(attrs, intAttr("client.port", int64(param.RemotePort)))
+	}
+	if v := strings.TrimPrefix(param.Proto, "HTTP/"); v != "" {
+		attrs = append(attrs, stringAttr("network.protocol.version", v))
+	}
+	if param.RequestBodySize > 0 {
+		attrs = append(attrs, intAttr("http.request.body.size", int64(param.RequestBodySize)))
+	}
+	if param.Request != nil {
+		if ua := param.Request.Header.UserAgent(); len(ua) > 0 {
+			attrs = append(attrs, stringAttr("user_agent.original", string(ua)))
+		}
+	}
+	if param.StatusCode >= 500 {
+		attrs = append(attrs, stringAttr("error.type", strconv.Itoa(param.StatusCode)))
+	}
+	// attribute keys are unique: a panic is the exception over ErrorMessage
+	if param.Panic != nil {
+		attrs = append(attrs, stringAttr("exception.message", fmt.Sprint(param.Panic)))
+		if param.Stack != "" {
+			attrs = append(attrs, stringAttr("exception.stacktrace", param.Stack))
+		}
+	} else if param.ErrorMessage != "" {
+		attrs = append(attrs, stringAttr("exception.message", strings.TrimSpace(param.ErrorMessage)))
+	}
+	if param.InFlight {
+		attrs = append(attrs, boolAttr("http.server.in_flight", true))
+	}
+	return attrs
+}
+
+// otlpSeverity returns the OpenTelemetry severity number of level.
+func otlpSeverity(level hlog.Level) (int, string) {
+	switch level {
+	case hlog.LevelError:
+		return 17, "ERROR"
+	case hlog.LevelWarn:
+		return 13, "WARN"
+	default:
+		return 9, "INFO"
+	}
+}
+
+const otlpScopeName = "github.com/FlameMida/accessLog"
+
+// encodeOTLPLogsProto encodes an ExportLogsServiceRequest.
+func encodeOTLPLogsProto(resource []otlpAttr, records []otlpRecord) []byte {
+	return appendMessageField(nil, 1, func(b []byte) []byte { // resource_logs
+		b = appendMessageField(b, 1, func(b []byte) []byte { // resource
+			return appendAttrsProto(b, 1, resource)
+		})
+		return appendMessageField(b, 2, func(b []byte) []byte { // scope_logs
+			b = appendMessageField(b, 1, func(b []byte) []byte { // scope
+				return appendStringField(b, 1, otlpScopeName)
+			})
+			for i := range records {
+				b = appendMessageField(b, 2, records[i].appendProto) // log_records
+			}
+			return b
+		})
+	})
+}
+
+// appendProto appends the LogRecord message of r.
+func (r *otlpRecord) appendProto(b []byte) []byte {
+	number, text := otlpSeverity(r.severity)
+	b = appendFixed64Field(b, 1, uint64(r.time.UnixNano()))
+	b = appendVarintField(b, 2, uint64(number))
+	b = appendStringField(b, 3, text)
+	b = appendMessageField(b, 5, func(b []byte) []byte {
+		return otlpAttr{kind: otlpString, s: r.body}.appendValueProto(b)
+	})
+	b = appendAttrsProto(b, 6, r.attrs)
+	if r.hasTrace {
+		b = appendFixed32Field(b, 8, uint32(r.trace.flags))
+		b = appendBytesField(b, 9, r.trace.traceID[:])
+		b = appendBytesField(b, 10, r.trace.spanID[:])
+	}
+	return appendFixed64Field(b, 11, uint64(r.observed.UnixNano()))
+}
+
+// appendAttrsProto appends attrs as repeated KeyValue field.
+func appendAttrsProto(b []byte, field int, attrs []otlpAttr) []byte {
+	for _, a := range attrs {
+		b = appendMessageField(b, field, func(b []byte) []byte {
+			b = appendStringField(b, 1, a.key)
+			return appendMessageField(b, 2, a.appendValueProto)
+		})
+	}
+	return b
+}
+
+// appendValueProto appends the fields of the AnyValue of a. Unlike the other
+// fields, the oneof value is written even when it is the zero value.
+func (a otlpAttr) appendValueProto(b []byte) []byte {
+	switch a.kind {
+	case otlpBool:
+		b = appendTag(b, 2, wireVarint)
+		if a.b {
+			return append(b, 1)
+		}
+		return append(b, 0)
+	case otlpInt:
+		return binary.AppendUvarint(appendTag(b, 3, wireVarint), uint64(a.i))
+	case otlpDouble:
+		return appendDoubleField(b, 4, a.f)
+	default:
+		return appendBytesField(b, 1, []byte(a.s))
+	}
+}
+
+// The OTLP JSON mapping: camelCase names, 64 bit integers as strings and
+// trace and span IDs as hex.
+
+type otlpJSONValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    string   `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpJSONKeyValue struct {
+	Key   string        `json:"key"`
+	Value otlpJSONValue `json:"value"`
+}
+
+func (a otlpAttr) jsonValue() otlpJSONValue {
+	switch a.kind {
+	case otlpBool:
+		return otlpJSONValue{BoolValue: &a.b}
+	case otlpInt:
+		return otlpJSONValue{IntValue: strconv.FormatInt(a.i, 10)}
+	case otlpDouble:
+		if math.IsNaN(a.f) || math.IsInf(a.f, 0) {
+			s := strconv.FormatFloat(a.f, 'g', -1, 64)
+			return otlpJSONValue{StringValue: &s}
+		}
+		return otlpJSONValue{DoubleValue: &a.f}
+	default:
+		return otlpJSONValue{StringValue: &a.s}
+	}
+}
+
+func otlpJSONAttrs(attrs []otlpAttr) []otlpJSONKeyValue {
+	kvs := make([]otlpJSONKeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		kvs = append(kvs, otlpJSONKeyValue{Key: a.key, Value: a.jsonValue()})
+	}
+	return kvs
+}
+
+type otlpJSONResource struct {
+	Attributes []otlpJSONKeyValue `json:"attributes"`
+}
+
+type otlpJSONScope struct {
+	Name string `json:"name"`
+}
+
+type otlpJSONLogRecord struct {
+	TimeUnixNano         string             `json:"timeUnixNano"`
+	ObservedTimeUnixNano string             `json:"observedTimeUnixNano"`
+	SeverityNumber       int                `json:"severityNumber"`
+	SeverityText         string             `json:"severityText"`
+	Body                 otlpJSONValue      `json:"body"`
+	Attributes           []otlpJSONKeyValue `json:"attributes"`
+	Flags                uint32             `json:"flags,omitempty"`
+	TraceID              string             `json:"traceId,omitempty"`
+	SpanID               string             `json:"spanId,omitempty"`
+}
+
+// encodeOTLPLogsJSON encodes an ExportLogsServiceRequest in the JSON mapping.
+func encodeOTLPLogsJSON(resource []otlpAttr, records []otlpRecord) []byte {
+	logRecords := make([]otlpJSONLogRecord, 0, len(records))
+	for i := range records {
+		r := &records[i]
+		number, text := otlpSeverity(r.severity)
+		lr := otlpJSONLogRecord{
+			TimeUnixNano:         strconv.FormatInt(r.time.UnixNano(), 10),
+			ObservedTimeUnixNano: strconv.FormatInt(r.observed.UnixNano(), 10),
+			SeverityNumber:       number,
+			SeverityText:         text,
+			Body:                 otlpAttr{kind: otlpString, s: r.body}.jsonValue(),
+			Attributes:           otlpJSONAttrs(r.attrs),
+		}
+		if r.hasTrace {
+			lr.Flags = uint32(r.trace.flags)
+			lr.TraceID = hex.EncodeToString(r.trace.traceID[:])
+			lr.SpanID = hex.EncodeToString(r.trace.spanID[:])
+		}
+		logRecords = append(logRecords, lr)
+	}
+
+	type scopeLogs struct {
+		Scope      otlpJSONScope       `json:"scope"`
+		LogRecords []otlpJSONLogRecord `json:"logRecords"`
+	}
+	type resourceLogs struct {
+		Resource  otlpJSONResource `json:"resource"`
+		ScopeLogs []scopeLogs      `json:"scopeLogs"`
+	}
+	payload := struct {
+		ResourceLogs []resourceLogs `json:"resourceLogs"`
+	}{
+		ResourceLogs: []resourceLogs{{
+			Resource: otlpJSONResource{Attributes: otlpJSONAttrs(resource)},
+			ScopeLogs: []scopeLogs{{
+				Scope:      otlpJSONScope{Name: otlpScopeName},
+				LogRecords: logRecords,
+			}},
+		}},
+	}
+
+	body, _ := json.Marshal(payload)
+	return body
+}
@@ -0,0 +1,283 @@
+package accessLog
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// protoField is a decoded protobuf field, its varint or fixed value in n.
+type protoField struct {
+	n    uint64
+	data []byte
+}
+
+// protoFields decodes the fields of a protobuf message by number.
+func protoFields(t *testing.T, b []byte) map[int][]protoField {
+	fields := make(map[int][]protoField)
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if !assert.Greater(t, n, 0) {
+			return fields
+		}
+		b = b[n:]
+		var f protoField
+		switch tag & 7 {
+		case wireVarint:
+			f.n, n = binary.Uvarint(b)
+			b = b[n:]
+		case wireFixed64:
+			f.n = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case wireFixed32:
+			f.n = uint64(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			f.data = b[n : n+int(l)]
+			b = b[n+int(l):]
+		}
+		fields[int(tag>>3)] = append(fields[int(tag>>3)], f)
+	}
+	return fields
+}
+
+// otlpCollector records the bodies posted to it.
+type otlpCollector struct {
+	mu       sync.Mutex
+	bodies   [][]byte
+	headers  []http.Header
+	statuses []int
+}
+
+func (o *otlpCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.bodies = append(o.bodies, body)
+	o.headers = append(o.headers, r.Header.Clone())
+	if len(o.statuses) > 0 {
+		w.WriteHeader(o.statuses[0])
+		o.statuses = o.statuses[1:]
+	}
+}
+
+func TestOTLPExporterJSON(t *testing.T) {
+	collector := &otlpCollector{}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	exporter := NewOTLPExporter(OTLPConfig{
+		Endpoint: srv.URL + "/v1/logs",
+		Encoding: OTLPJSON,
+		Headers:  map[string]string{"Authorization": "Bearer token"},
+		Resource: map[string]string{"service.name": "shop"},
+	})
+
+	router := route.NewEngine(config.NewOptions([]config.Option{}))
+	router.Use(LoggerWithConfig(LoggerConfig{Sink: exporter}))
+	router.GET("/users/:id", func(c context.Context, ctx *app.RequestContext) {})
+
+	_ = ut.PerformRequest(router, "GET", "/users/1?a=b", nil,
+		ut.Header{Key: "traceparent", Value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		ut.Header{Key: "User-Agent", Value: "test-agent"})
+	_ = ut.PerformRequest(router, "GET", "/notfound", nil)
+	assert.NoError(t, exporter.Close())
+
+	assert.Len(t, collector.bodies, 1)
+	assert.Equal(t, "application/json", collector.headers[0].Get("Content-Type"))
+	assert.Equal(t, "Bearer token", collector.headers[0].Get("Authorization"))
+
+	var payload struct {
+		ResourceLogs []struct {
+			Resource struct {
+				Attributes []otlpJSONKeyValue
+			}
+			ScopeLogs []struct {
+				LogRecords []map[string]any
+			}
+		}
+	}
+	assert.NoError(t, json.Unmarshal(collector.bodies[0], &payload))
+	assert.Equal(t, "service.name", payload.ResourceLogs[0].Resource.Attributes[0].Key)
+	assert.Equal(t, "shop", *payload.ResourceLogs[0].Resource.Attributes[0].Value.StringValue)
+
+	records := payload.ResourceLogs[0].ScopeLogs[0].LogRecords
+	assert.Len(t, records, 2)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", records[0]["traceId"])
+	assert.Equal(t, "00f067aa0ba902b7", records[0]["spanId"])
+	assert.Equal(t, float64(1), records[0]["flags"])
+	assert.Equal(t, float64(9), records[0]["severityNumber"])
+	assert.Equal(t, float64(13), records[1]["severityNumber"])
+	assert.Nil(t, records[1]["traceId"])
+
+	attrs := make(map[string]any)
+	for _, a := range records[0]["attributes"].([]any) {
+		kv := a.(map[string]any)
+		for _, v := range kv["value"].(map[string]any) {
+			attrs[kv["key"].(string)] = v
+		}
+	}
+	assert.Equal(t, "GET", attrs["http.request.method"])
+	assert.Equal(t, "200", attrs["http.response.status_code"])
+	assert.Equal(t, "/users/1", attrs["url.path"])
+	assert.Equal(t, "a=b", attrs["url.query"])
+	assert.Equal(t, "/users/:id", attrs["http.route"])
+	assert.Equal(t, "test-agent", attrs["user_agent.original"])
+	assert.Contains(t, attrs, "client.address")
+}
+
+func TestOTLPExporterProtobuf(t *testing.T) {
+	collector := &otlpCollector{statuses: []int{http.StatusServiceUnavailable}}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	exporter := NewOTLPExporter(OTLPConfig{
+		Endpoint: srv.URL,
+		Batch:    BatchConfig{MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond},
+	})
+	exporter.Emit(context.Background(), LogFormatterParams{
+		TimeStamp:  time.Unix(0, 42),
+		Method:     "POST",
+		Path:       "/orders",
+		Route:      "/orders",
+		StatusCode: 500,
+	})
+	assert.NoError(t, exporter.Close())
+
+	// the first attempt was answered 503 and retried
+	assert.Len(t, collector.bodies, 2)
+	assert.Equal(t, collector.bodies[0], collector.bodies[1])
+	assert.Equal(t, "application/x-protobuf", collector.headers[1].Get("Content-Type"))
+
+	req := protoFields(t, collector.bodies[1])
+	resourceLogs := protoFields(t, req[1][0].data)
+	resource := protoFields(t, resourceLogs[1][0].data)
+	kv := protoFields(t, resource[1][0].data)
+	assert.Equal(t, "service.name", string(kv[1][0].data))
+	assert.Equal(t, "unknown_service", string(protoFields(t, kv[2][0].data)[1][0].data))
+
+	scopeLogs := protoFields(t, resourceLogs[2][0].data)
+	assert.Equal(t, otlpScopeName, string(protoFields(t, scopeLogs[1][0].data)[1][0].data))
+	record := protoFields(t, scopeLogs[2][0].data)
+	assert.Equal(t, uint64(42), record[1][0].n)
+	assert.Equal(t, uint64(17), record[2][0].n)
+	assert.Equal(t, "ERROR", string(record[3][0].data))
+	assert.Equal(t, "POST /orders 500", string(protoFields(t, record[5][0].data)[1][0].data))
+	assert.Empty(t, record[9])
+
+	attrs := make(map[string]protoField)
+	for _, f := range record[6] {
+		kv := protoFields(t, f.data)
+		for _, v := range protoFields(t, kv[2][0].data) {
+			attrs[string(kv[1][0].data)] = v[0]
+		}
+	}
+	assert.Equal(t, "POST", string(attrs["http.request.method"].data))
+	assert.Equal(t, uint64(500), attrs["http.response.status_code"].n)
+	assert.Equal(t, "500", string(attrs["error.type"].data))
+}
+
+func TestOTLPExporterPermanentError(t *testing.T) {
+	collector := &otlpCollector{statuses: []int{http.StatusBadRequest}}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	var errs []error
+	exporter := NewOTLPExporter(OTLPConfig{
+		Endpoint:     srv.URL,
+		Batch:        BatchConfig{MinBackoff: time.Millisecond},
+		ErrorHandler: func(err error) { errs = append(errs, err) },
+	})
+	exporter.Emit(context.Background(), LogFormatterParams{StatusCode: 200})
+	assert.NoError(t, exporter.Close())
+
+	assert.Len(t, collector.bodies, 1)
+	assert.Len(t, errs, 1)
+	assert.Contains(t, errs[0].Error(), "400 Bad Request")
+
+	exporter.Emit(context.Background(), LogFormatterParams{StatusCode: 200})
+	assert.Equal(t, uint64(1), exporter.Dropped())
+}
+
+func TestParseTraceParent(t *testing.T) {
+	tp, ok := parseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.True(t, ok)
+	assert.Equal(t, byte(0x4b), tp.traceID[0])
+	assert.Equal(t, byte(0xb7), tp.spanID[7])
+	assert.Equal(t, byte(1), tp.flags)
+
+	_, ok = parseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-future")
+	assert.True(t, ok)
+
+	for _, v := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		_, ok := parseTraceParent(v)
+		assert.False(t, ok, v)
+	}
+}
+
+func TestOTLPExporterRetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	// the Retry-After delay is capped at MaxBackoff
+	exporter := NewOTLPExporter(OTLPConfig{
+		Endpoint: srv.URL,
+		Batch:    BatchConfig{FlushInterval: 10 * time.Millisecond, MaxRetries: 2, MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond},
+	})
+	exporter.Emit(context.Background(), LogFormatterParams{StatusCode: 200})
+	assert.Eventually(t, func() bool { return requests.Load() == 3 }, time.Second, 10*time.Millisecond)
+	assert.NoError(t, exporter.Close())
+
+	// a done context interrupts the wait between retries
+	requests.Store(0)
+	exporter = NewOTLPExporter(OTLPConfig{Endpoint: srv.URL, Batch: BatchConfig{MaxBackoff: time.Hour}})
+	defer exporter.Close()
+	c, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.Error(t, exporter.EmitBatch(c, []LogFormatterParams{{StatusCode: 200}}))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestHTTPAttrsUniqueKeys(t *testing.T) {
+	attrs := httpAttrs(&LogFormatterParams{StatusCode: 500, ErrorMessage: "Error #01: db down\n", Panic: "boom", Stack: "goroutine 1"})
+
+	seen := map[string]string{}
+	for _, a := range attrs {
+		_, dup := seen[a.key]
+		assert.False(t, dup, a.key)
+		seen[a.key] = a.s
+	}
+	assert.Equal(t, "boom", seen["exception.message"])
+	assert.Equal(t, "goroutine 1", seen["exception.stacktrace"])
+
+	attrs = httpAttrs(&LogFormatterParams{StatusCode: 500, ErrorMessage: "Error #01: db down\n"})
+	assert.Contains(t, attrs, stringAttr("exception.message", "Error #01: db down"))
+}
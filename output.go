@@ -0,0 +1,72 @@
+package accessLog
+
+import (
+	"context"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"io"
+)
+
+// Output is a destination of access events with its own format and selection.
+type Output struct {
+	// Writer is where the formatted events are written. Its errors are
+	// reported to ErrorHandler; wrap it with NewBreakerWriter to stop writing
+	// to it while it fails.
+	// Optional. Default value is DefaultWriter.
+	Writer io.Writer
+
+	// ErrorHandler is called with the write errors of Writer.
+	// Optional. Default value is LoggerConfig.ErrorHandler.
+	ErrorHandler func(err error)
+
+	// Formatter formats the events written to Writer.
+	// Optional. Default value is defaultLogFormatter.
+	Formatter LogFormatter
+
+	// Sink receives the selected events instead of Formatter and Writer.
+	// Optional.
+	Sink Sink
+
+	// Filter selects the events of the output.
+	// Optional. Default value matches every event.
+	Filter EventFilter
+
+	// MinLevel is the lowest Level of the events of the output.
+	// Optional. Default value is hlog.LevelTrace, every event.
+	MinLevel hlog.Level
+}
+
+// MultiSink is a Sink handing every access event to several outputs, each
+// one keeping the events matching its filter and level.
+type MultiSink struct {
+	outputs []multiOutput
+}
+
+type multiOutput struct {
+	sink     Sink
+	filter   EventFilter
+	minLevel hlog.Level
+}
+
+// NewMultiSink instance a MultiSink with outputs.
+func NewMultiSink(outputs ...Output) *MultiSink {
+	s := &MultiSink{outputs: make([]multiOutput, len(outputs))}
+	for i, o := range outputs {
+		sink := o.Sink
+		if sink == nil {
+			sink = newSink(LoggerConfig{Formatter: o.Formatter, Output: o.Writer, ErrorHandler: o.ErrorHandler})
+		}
+		s.outputs[i] = multiOutput{sink: sink, filter: o.Filter, minLevel: o.MinLevel}
+	}
+	return s
+}
+
+// Emit implements Sink.
+func (s *MultiSink) Emit(c context.Context, param LogFormatterParams) {
+	level := param.Level()
+	for i := range s.outputs {
+		o := &s.outputs[i]
+		if level >= o.minLevel && o.filter.Match(&param) {
+			o.sink.Emit(c, param)
+		}
+	}
+}
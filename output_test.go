@@ -0,0 +1,53 @@
+package accessLog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestLoggerWithOutputs(t *testing.T) {
+	console, file, errorsOnly, warnings := new(bytes.Buffer), new(bytes.Buffer), new(bytes.Buffer), new(bytes.Buffer)
+	var sunk []int
+	router := route.NewEngine(config.NewOptions([]config.Option{}))
+	router.Use(LoggerWithConfig(LoggerConfig{Outputs: []Output{
+		{Writer: console},
+		{Writer: file, Formatter: JSONLogFormatter},
+		{Writer: errorsOnly, Filter: EventFilter{MinStatus: 500, MaxStatus: 599}, Formatter: func(param LogFormatterParams) string {
+			return param.Path + "\n"
+		}},
+		{Writer: warnings, MinLevel: hlog.LevelWarn, Formatter: func(param LogFormatterParams) string {
+			return param.Path + "\n"
+		}},
+		{Sink: SinkFunc(func(_ context.Context, param LogFormatterParams) {
+			sunk = append(sunk, param.StatusCode)
+		}), Filter: EventFilter{Method: "GET"}},
+	}}))
+	router.GET("/ok", func(c context.Context, ctx *app.RequestContext) {})
+	router.GET("/missing", func(c context.Context, ctx *app.RequestContext) { ctx.Status(404) })
+	router.POST("/fail", func(c context.Context, ctx *app.RequestContext) { ctx.Status(500) })
+
+	_ = ut.PerformRequest(router, "GET", "/ok", nil)
+	_ = ut.PerformRequest(router, "GET", "/missing", nil)
+	_ = ut.PerformRequest(router, "POST", "/fail", nil)
+
+	assert.Equal(t, 3, strings.Count(console.String(), "[Hertz]"))
+
+	lines := strings.Split(strings.TrimSpace(file.String()), "\n")
+	assert.Len(t, lines, 3)
+	var event map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(lines[2]), &event))
+	assert.Equal(t, "/fail", event["path"])
+
+	assert.Equal(t, "/fail\n", errorsOnly.String())
+	assert.Equal(t, "/missing\n/fail\n", warnings.String())
+	assert.Equal(t, []int{200, 404}, sunk)
+}
@@ -0,0 +1,291 @@
+package accessLog
+
+import (
+	"context"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PercentilesConfig defines the config for Percentiles.
+type PercentilesConfig struct {
+	// Window is the sliding time window the percentiles are computed over.
+	// Optional. Default value is 5 minutes.
+	Window time.Duration
+
+	// Slots is the number of sub-windows the window slides by. Events leave the
+	// window one slot, Window / Slots, at a time.
+	// Optional. Default value is 10.
+	Slots int
+
+	// RelativeAccuracy bounds the relative error of the reported percentiles.
+	// Optional. Default value is 0.01.
+	RelativeAccuracy float64
+}
+
+// RouteLatency summarizes the latency of one route template over a window.
+type RouteLatency struct {
+	// Route is the route template, empty for the requests which matched none.
+	Route string `json:"route"`
+	// Count is the number of requests.
+	Count uint64 `json:"count"`
+	// Errors is the number of requests which failed with a 5xx status or a panic.
+	Errors uint64 `json:"errors"`
+	// ErrorRate is Errors divided by Count.
+	ErrorRate float64 `json:"error_rate"`
+	// P50, P90, P99 and P999 are the latency percentiles, in nanoseconds in JSON.
+	P50  time.Duration `json:"p50"`
+	P90  time.Duration `json:"p90"`
+	P99  time.Duration `json:"p99"`
+	P999 time.Duration `json:"p999"`
+}
+
+// Percentiles is a Sink estimating latency percentiles per route template over
+// a sliding time window. Latencies are counted in logarithmic buckets, so the
+// percentiles have a bounded relative error whatever their magnitude.
+type Percentiles struct {
+	conf     PercentilesConfig
+	slot     time.Duration
+	logGamma float64
+
+	mu    sync.Mutex
+	slots []percentileSlot
+}
+
+// percentileSlot holds the sketches of one sub-window, identified by its epoch,
+// the start of the sub-window divided by the slot duration.
+type percentileSlot struct {
+	epoch  int64
+	routes map[string]*latencySketch
+}
+
+// latencySketch counts latencies in buckets growing by a constant factor gamma,
+// bucket i holding the values in (gamma^(i-1), gamma^i].
+type latencySketch struct {
+	buckets map[int]uint64
+	zero    uint64
+	count   uint64
+	errors  uint64
+}
+
+// NewPercentiles instance a Percentiles with config.
+func NewPercentiles(conf PercentilesConfig) *Percentiles {
+	if conf.Window <= 0 {
+		conf.Window = 5 * time.Minute
+	}
+	if conf.Slots <= 0 {
+		conf.Slots = 10
+	}
+	if conf.RelativeAccuracy <= 0 || conf.RelativeAccuracy >= 1 {
+		conf.RelativeAccuracy = 0.01
+	}
+
+	gamma := (1 + conf.RelativeAccuracy) / (1 - conf.RelativeAccuracy)
+	slot := conf.Window / time.Duration(conf.Slots)
+	if slot <= 0 {
+		slot = 1
+	}
+	return &Percentiles{
+		conf:     conf,
+		slot:     slot,
+		logGamma: math.Log(gamma),
+		slots:    make([]percentileSlot, conf.Slots),
+	}
+}
+
+// Emit implements Sink. Events of requests still running and the final
+// events of hijacked connections are not counted.
+func (p *Percentiles) Emit(_ context.Context, param LogFormatterParams) {
+	if param.InFlight || param.Hijacked {
+		return
+	}
+
+	ts := param.TimeStamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	epoch := ts.UnixNano() / int64(p.slot)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	s := &p.slots[epoch%int64(len(p.slots))]
+	if s.epoch != epoch {
+		if s.epoch > epoch && s.routes != nil {
+			// the event is older than the window
+			return
+		}
+		s.epoch = epoch
+		s.routes = make(map[string]*latencySketch)
+	}
+
+	sk, ok := s.routes[param.Route]
+	if !ok {
+		sk = &latencySketch{buckets: make(map[int]uint64)}
+		s.routes[param.Route] = sk
+	}
+	p.add(sk, float64(param.Latency))
+	if param.Level() == hlog.LevelError {
+		sk.errors++
+	}
+}
+
+func (p *Percentiles) add(sk *latencySketch, v float64) {
+	sk.count++
+	if v < 1 {
+		sk.zero++
+		return
+	}
+	sk.buckets[int(math.Ceil(math.Log(v)/p.logGamma))]++
+}
+
+// Routes returns the latency summary of every route template seen within the
+// last window, sorted by route. A window of 0, or longer than the configured
+// one, means the configured window.
+func (p *Percentiles) Routes(window time.Duration) []RouteLatency {
+	merged := p.merge(window)
+
+	routes := make([]RouteLatency, 0, len(merged))
+	for route, sk := range merged {
+		routes = append(routes, p.summarize(route, sk))
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].Route < routes[j].Route
+	})
+	return routes
+}
+
+// Route returns the latency summary of route within the last window, false
+// when it saw no request.
+func (p *Percentiles) Route(route string, window time.Duration) (RouteLatency, bool) {
+	sk, ok := p.merge(window)[route]
+	if !ok {
+		return RouteLatency{}, false
+	}
+	return p.summarize(route, sk), true
+}
+
+// Quantile returns the q-quantile, 0 <= q <= 1, of the latency of route
+// within the last window, 0 when it saw no request.
+func (p *Percentiles) Quantile(route string, q float64, window time.Duration) time.Duration {
+	sk, ok := p.merge(window)[route]
+	if !ok {
+		return 0
+	}
+	return p.quantile(sk, q)
+}
+
+// Handler returns a Hertz handler serving the latency summaries as JSON. The
+// route query parameter keeps one route template and window, a duration such
+// as 1m, narrows the window.
+func (p *Percentiles) Handler() app.HandlerFunc {
+	return func(c context.Context, ctx *app.RequestContext) {
+		var window time.Duration
+		if v := ctx.Query("window"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				ctx.AbortWithMsg("invalid window: "+err.Error(), consts.StatusBadRequest)
+				return
+			}
+			window = d
+		}
+
+		routes := p.Routes(window)
+		if route, ok := ctx.GetQuery("route"); ok {
+			filtered := make([]RouteLatency, 0, 1)
+			for _, r := range routes {
+				if r.Route == route {
+					filtered = append(filtered, r)
+				}
+			}
+			routes = filtered
+		}
+
+		ctx.JSON(consts.StatusOK, routes)
+	}
+}
+
+// merge returns the sketches of the slots within the last window merged by route.
+func (p *Percentiles) merge(window time.Duration) map[string]*latencySketch {
+	n := int64(len(p.slots))
+	if window > 0 && window < p.conf.Window {
+		n = int64((window + p.slot - 1) / p.slot)
+	}
+	current := time.Now().UnixNano() / int64(p.slot)
+
+	merged := make(map[string]*latencySketch)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := range p.slots {
+		s := &p.slots[i]
+		if s.routes == nil || s.epoch <= current-n || s.epoch > current {
+			continue
+		}
+		for route, sk := range s.routes {
+			m, ok := merged[route]
+			if !ok {
+				m = &latencySketch{buckets: make(map[int]uint64, len(sk.buckets))}
+				merged[route] = m
+			}
+			for b, count := range sk.buckets {
+				m.buckets[b] += count
+			}
+			m.zero += sk.zero
+			m.count += sk.count
+			m.errors += sk.errors
+		}
+	}
+	return merged
+}
+
+func (p *Percentiles) summarize(route string, sk *latencySketch) RouteLatency {
+	r := RouteLatency{
+		Route:  route,
+		Count:  sk.count,
+		Errors: sk.errors,
+		P50:    p.quantile(sk, 0.5),
+		P90:    p.quantile(sk, 0.9),
+		P99:    p.quantile(sk, 0.99),
+		P999:   p.quantile(sk, 0.999),
+	}
+	if sk.count > 0 {
+		r.ErrorRate = float64(sk.errors) / float64(sk.count)
+	}
+	return r
+}
+
+// quantile returns the estimate of the q-quantile of sk, the midpoint of the
+// bucket holding the value of rank q*(count-1).
+func (p *Percentiles) quantile(sk *latencySketch, q float64) time.Duration {
+	if sk.count == 0 {
+		return 0
+	}
+	q = math.Max(0, math.Min(1, q))
+	rank := uint64(q * float64(sk.count-1))
+
+	if rank < sk.zero {
+		return 0
+	}
+	cumulative := sk.zero
+
+	keys := make([]int, 0, len(sk.buckets))
+	for b := range sk.buckets {
+		keys = append(keys, b)
+	}
+	sort.Ints(keys)
+
+	for _, b := range keys {
+		cumulative += sk.buckets[b]
+		if cumulative > rank {
+			gamma := math.Exp(p.logGamma)
+			return time.Duration(2 * math.Pow(gamma, float64(b)) / (gamma + 1))
+		}
+	}
+	return 0
+}
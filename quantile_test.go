@@ -0,0 +1,100 @@
+package accessLog
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestPercentiles(t *testing.T) {
+	p := NewPercentiles(PercentilesConfig{})
+
+	now := time.Now()
+	for i := 1; i <= 1000; i++ {
+		status := 200
+		if i%100 == 0 {
+			status = 500
+		}
+		p.Emit(context.Background(), LogFormatterParams{
+			TimeStamp:  now,
+			Route:      "/checkout",
+			StatusCode: status,
+			Latency:    time.Duration(i) * time.Millisecond,
+		})
+	}
+	p.Emit(context.Background(), LogFormatterParams{TimeStamp: now, Route: "/checkout", InFlight: true, Latency: time.Hour})
+
+	r, ok := p.Route("/checkout", 0)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1000), r.Count)
+	assert.Equal(t, uint64(10), r.Errors)
+	assert.InDelta(t, 0.01, r.ErrorRate, 1e-9)
+	assert.InEpsilon(t, float64(500*time.Millisecond), float64(r.P50), 0.02)
+	assert.InEpsilon(t, float64(900*time.Millisecond), float64(r.P90), 0.02)
+	assert.InEpsilon(t, float64(990*time.Millisecond), float64(r.P99), 0.02)
+	assert.InEpsilon(t, float64(999*time.Millisecond), float64(r.P999), 0.02)
+	assert.InEpsilon(t, float64(250*time.Millisecond), float64(p.Quantile("/checkout", 0.25, 0)), 0.02)
+
+	_, ok = p.Route("/other", 0)
+	assert.False(t, ok)
+	assert.Equal(t, time.Duration(0), p.Quantile("/other", 0.5, 0))
+}
+
+func TestPercentilesWindow(t *testing.T) {
+	p := NewPercentiles(PercentilesConfig{Window: time.Minute, Slots: 6})
+
+	now := time.Now()
+	p.Emit(context.Background(), LogFormatterParams{TimeStamp: now, Route: "/a", Latency: time.Millisecond})
+	p.Emit(context.Background(), LogFormatterParams{TimeStamp: now.Add(-30 * time.Second), Route: "/a", Latency: time.Second})
+	p.Emit(context.Background(), LogFormatterParams{TimeStamp: now.Add(-2 * time.Minute), Route: "/b", Latency: time.Second})
+
+	routes := p.Routes(0)
+	assert.Len(t, routes, 1)
+	assert.Equal(t, "/a", routes[0].Route)
+	assert.Equal(t, uint64(2), routes[0].Count)
+
+	r, ok := p.Route("/a", 10*time.Second)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), r.Count)
+	assert.InEpsilon(t, float64(time.Millisecond), float64(r.P99), 0.02)
+}
+
+func TestPercentilesHandler(t *testing.T) {
+	p := NewPercentiles(PercentilesConfig{})
+
+	router := route.NewEngine(config.NewOptions([]config.Option{}))
+	router.Use(LoggerWithConfig(LoggerConfig{Sink: p, SkipPaths: []string{"/debug/latency"}}))
+	router.GET("/debug/latency", p.Handler())
+	router.GET("/users/:id", func(c context.Context, ctx *app.RequestContext) {})
+	router.GET("/fail", func(c context.Context, ctx *app.RequestContext) {
+		ctx.AbortWithStatus(500)
+	})
+
+	_ = ut.PerformRequest(router, "GET", "/users/1", nil)
+	_ = ut.PerformRequest(router, "GET", "/users/2", nil)
+	_ = ut.PerformRequest(router, "GET", "/fail", nil)
+
+	w := ut.PerformRequest(router, "GET", "/debug/latency", nil)
+	assert.Equal(t, 200, w.Code)
+	var routes []RouteLatency
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &routes))
+	assert.Len(t, routes, 2)
+	assert.Equal(t, "/fail", routes[0].Route)
+	assert.Equal(t, 1.0, routes[0].ErrorRate)
+	assert.Equal(t, "/users/:id", routes[1].Route)
+	assert.Equal(t, uint64(2), routes[1].Count)
+
+	w = ut.PerformRequest(router, "GET", "/debug/latency?route=/users/:id&window=1m", nil)
+	routes = nil
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &routes))
+	assert.Len(t, routes, 1)
+
+	w = ut.PerformRequest(router, "GET", "/debug/latency?window=soon", nil)
+	assert.Equal(t, 400, w.Code)
+}
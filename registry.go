@@ -0,0 +1,161 @@
+package accessLog
+
+import (
+	"context"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// InFlightRequest describes a request being processed by the Logger middleware.
+type InFlightRequest struct {
+	// ID is the X-Request-ID header of the request, or a sequence number when it has none.
+	ID string `json:"id"`
+	// Method is the HTTP method given to the request.
+	Method string `json:"method"`
+	// Path is a path the client requests.
+	Path string `json:"path"`
+	// Route is the route template the request matched, empty when none did.
+	Route string `json:"route"`
+	// Host is a Host the client requests.
+	Host string `json:"host"`
+	// ClientIP equals Context's ClientIP method when the request started.
+	ClientIP string `json:"client_ip"`
+	// Start is the time the request entered the Logger middleware.
+	Start time.Time `json:"start"`
+}
+
+// Registry keeps track of the requests in flight through the Logger middleware.
+type Registry struct {
+	mu       sync.Mutex
+	requests map[*inFlight]struct{}
+	seq      uint64
+}
+
+// inFlight is the registry entry of a request, watched against the slow thresholds.
+type inFlight struct {
+	InFlightRequest
+
+	mu         sync.Mutex
+	timer      *time.Timer
+	next       int
+	thresholds []time.Duration
+	onSlow     func(req InFlightRequest, elapsed time.Duration)
+}
+
+// NewRegistry instance an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{requests: make(map[*inFlight]struct{})}
+}
+
+// Len returns the number of requests currently in flight.
+func (r *Registry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.requests)
+}
+
+// InFlight returns the requests currently in flight, oldest first.
+func (r *Registry) InFlight() []InFlightRequest {
+	r.mu.Lock()
+	reqs := make([]InFlightRequest, 0, len(r.requests))
+	for e := range r.requests {
+		reqs = append(reqs, e.InFlightRequest)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(reqs, func(i, j int) bool {
+		return reqs[i].Start.Before(reqs[j].Start)
+	})
+	return reqs
+}
+
+// Handler returns a Hertz handler serving the requests in flight as JSON,
+// oldest first. The route query parameter keeps the requests of one route
+// template and min_age, a duration such as 5s, the requests older than it.
+func (r *Registry) Handler() app.HandlerFunc {
+	type inFlightJSON struct {
+		InFlightRequest
+		Age string `json:"age"`
+	}
+
+	return func(c context.Context, ctx *app.RequestContext) {
+		var minAge time.Duration
+		if v := ctx.Query("min_age"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				ctx.AbortWithMsg("invalid min_age: "+err.Error(), consts.StatusBadRequest)
+				return
+			}
+			minAge = d
+		}
+		route, filterRoute := ctx.GetQuery("route")
+
+		now := time.Now()
+		reqs := make([]inFlightJSON, 0)
+		for _, req := range r.InFlight() {
+			age := now.Sub(req.Start)
+			if age < minAge || (filterRoute && req.Route != route) {
+				continue
+			}
+			reqs = append(reqs, inFlightJSON{InFlightRequest: req, Age: age.String()})
+		}
+
+		ctx.JSON(consts.StatusOK, reqs)
+	}
+}
+
+// nextID returns the next request sequence number.
+func (r *Registry) nextID() string {
+	return strconv.FormatUint(atomic.AddUint64(&r.seq, 1), 10)
+}
+
+// begin registers req, calling onSlow each time it exceeds one of the sorted thresholds.
+func (r *Registry) begin(req InFlightRequest, thresholds []time.Duration, onSlow func(InFlightRequest, time.Duration)) *inFlight {
+	e := &inFlight{InFlightRequest: req, thresholds: thresholds, onSlow: onSlow}
+
+	r.mu.Lock()
+	r.requests[e] = struct{}{}
+	r.mu.Unlock()
+
+	if len(thresholds) > 0 && onSlow != nil {
+		e.mu.Lock()
+		e.timer = time.AfterFunc(thresholds[0], e.fire)
+		e.mu.Unlock()
+	}
+	return e
+}
+
+// end unregisters e and stops watching it.
+func (r *Registry) end(e *inFlight) {
+	r.mu.Lock()
+	delete(r.requests, e)
+	r.mu.Unlock()
+
+	e.mu.Lock()
+	if e.timer != nil {
+		e.timer.Stop()
+	}
+	e.next = len(e.thresholds)
+	e.mu.Unlock()
+}
+
+// fire reports the request as still running and arms the next threshold.
+func (e *inFlight) fire() {
+	e.mu.Lock()
+	if e.next >= len(e.thresholds) {
+		e.mu.Unlock()
+		return
+	}
+	e.next++
+	if e.next < len(e.thresholds) {
+		e.timer = time.AfterFunc(time.Until(e.Start.Add(e.thresholds[e.next])), e.fire)
+	}
+	e.mu.Unlock()
+
+	e.onSlow(e.InFlightRequest, time.Since(e.Start))
+}
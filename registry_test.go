@@ -0,0 +1,141 @@
+package accessLog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoggerSlowThresholds(t *testing.T) {
+	var mu sync.Mutex
+	var params []LogFormatterParams
+	var inFlight []InFlightRequest
+	registry := NewRegistry()
+
+	router := route.NewEngine(config.NewOptions([]config.Option{}))
+	router.Use(LoggerWithConfig(LoggerConfig{
+		SlowThresholds: []time.Duration{60 * time.Millisecond, 20 * time.Millisecond},
+		Registry:       registry,
+		Sink: SinkFunc(func(c context.Context, param LogFormatterParams) {
+			mu.Lock()
+			params = append(params, param)
+			mu.Unlock()
+		}),
+	}))
+	router.GET("/slow", func(c context.Context, ctx *app.RequestContext) {
+		inFlight = registry.InFlight()
+		time.Sleep(100 * time.Millisecond)
+	})
+	router.GET("/fast", func(c context.Context, ctx *app.RequestContext) {})
+
+	_ = ut.PerformRequest(router, "GET", "/slow?a=1", nil)
+	assert.Len(t, inFlight, 1)
+	assert.Equal(t, "GET", inFlight[0].Method)
+	assert.Equal(t, "/slow?a=1", inFlight[0].Path)
+	assert.Empty(t, registry.InFlight())
+
+	mu.Lock()
+	assert.Len(t, params, 3)
+	assert.True(t, params[0].InFlight)
+	assert.Equal(t, "/slow?a=1", params[0].Path)
+	assert.Equal(t, "/slow", params[0].Route)
+	assert.GreaterOrEqual(t, params[0].Latency, 20*time.Millisecond)
+	assert.True(t, params[1].InFlight)
+	assert.GreaterOrEqual(t, params[1].Latency, 60*time.Millisecond)
+	assert.False(t, params[2].InFlight)
+	assert.True(t, params[2].Slow)
+	assert.Equal(t, 200, params[2].StatusCode)
+	params = nil
+	mu.Unlock()
+
+	_ = ut.PerformRequest(router, "GET", "/fast", nil)
+	time.Sleep(30 * time.Millisecond)
+	mu.Lock()
+	assert.Len(t, params, 1)
+	assert.False(t, params[0].Slow)
+	mu.Unlock()
+}
+
+func TestDefaultLogFormatterInFlight(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	sink := newSink(LoggerConfig{Output: buffer})
+	sink.Emit(context.Background(), LogFormatterParams{
+		TimeStamp: time.Unix(1544173902, 0).UTC(),
+		Latency:   5 * time.Second,
+		ClientIP:  "20.20.20.20",
+		Method:    "GET",
+		Path:      "/",
+		InFlight:  true,
+	})
+
+	assert.Equal(t, "[Hertz] 2018/12/07 - 09:11:42 | RUN |            5s |     20.20.20.20 | GET      \"/\" still running\n", buffer.String())
+}
+
+func TestLoggerRegistry(t *testing.T) {
+	var inFlight []InFlightRequest
+	registry := NewRegistry()
+
+	router := route.NewEngine(config.NewOptions([]config.Option{}))
+	router.Use(LoggerWithConfig(LoggerConfig{
+		Registry: registry,
+		Sink:     SinkFunc(func(c context.Context, param LogFormatterParams) {}),
+	}))
+	router.GET("/users/:id", func(c context.Context, ctx *app.RequestContext) {
+		inFlight = registry.InFlight()
+	})
+
+	_ = ut.PerformRequest(router, "GET", "/users/42", nil, ut.Header{Key: "X-Request-ID", Value: "req-1"})
+	assert.Len(t, inFlight, 1)
+	assert.Equal(t, "req-1", inFlight[0].ID)
+	assert.Equal(t, "/users/:id", inFlight[0].Route)
+	assert.Equal(t, "/users/42", inFlight[0].Path)
+
+	_ = ut.PerformRequest(router, "GET", "/users/43", nil)
+	assert.Len(t, inFlight, 1)
+	assert.Equal(t, "1", inFlight[0].ID)
+	assert.Empty(t, registry.InFlight())
+}
+
+func TestRegistryHandler(t *testing.T) {
+	registry := NewRegistry()
+	now := time.Now()
+	newer := registry.begin(InFlightRequest{ID: "newer", Route: "/b", Start: now.Add(-time.Second)}, nil, nil)
+	defer registry.end(newer)
+	older := registry.begin(InFlightRequest{ID: "older", Route: "/a", Start: now.Add(-10 * time.Second)}, nil, nil)
+	defer registry.end(older)
+
+	router := route.NewEngine(config.NewOptions([]config.Option{}))
+	router.GET("/debug/inflight", registry.Handler())
+
+	ids := func(url string) []string {
+		w := ut.PerformRequest(router, "GET", url, nil)
+		assert.Equal(t, 200, w.Code)
+		var reqs []struct {
+			ID  string `json:"id"`
+			Age string `json:"age"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &reqs))
+		var got []string
+		for _, r := range reqs {
+			assert.NotEmpty(t, r.Age)
+			got = append(got, r.ID)
+		}
+		return got
+	}
+
+	assert.Equal(t, []string{"older", "newer"}, ids("/debug/inflight"))
+	assert.Equal(t, []string{"newer"}, ids("/debug/inflight?route=/b"))
+	assert.Equal(t, []string{"older"}, ids("/debug/inflight?min_age=5s"))
+	assert.Empty(t, ids("/debug/inflight?route=/c"))
+
+	w := ut.PerformRequest(router, "GET", "/debug/inflight?min_age=soon", nil)
+	assert.Equal(t, 400, w.Code)
+}
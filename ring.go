@@ -0,0 +1,91 @@
+package accessLog
+
+import (
+	"context"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"strconv"
+	"sync"
+)
+
+// RingSink keeps the last access events in memory, to inspect recent traffic
+// without a log pipeline.
+type RingSink struct {
+	mu     sync.RWMutex
+	events []LogFormatterParams
+	next   int
+	full   bool
+}
+
+// NewRingSink instance a RingSink keeping the last size events.
+func NewRingSink(size int) *RingSink {
+	if size <= 0 {
+		size = 1
+	}
+	return &RingSink{events: make([]LogFormatterParams, size)}
+}
+
+// Emit implements Sink. The request is dropped to bound the memory kept.
+func (s *RingSink) Emit(_ context.Context, param LogFormatterParams) {
+	param.Request = nil
+
+	s.mu.Lock()
+	s.events[s.next] = param
+	s.next = (s.next + 1) % len(s.events)
+	if s.next == 0 {
+		s.full = true
+	}
+	s.mu.Unlock()
+}
+
+// Events returns the kept events selected by filter, oldest first.
+func (s *RingSink) Events(filter EventFilter) []LogFormatterParams {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []LogFormatterParams
+	visit := func(from, to int) {
+		for i := from; i < to; i++ {
+			if filter.Match(&s.events[i]) {
+				events = append(events, s.events[i])
+			}
+		}
+	}
+	if s.full {
+		visit(s.next, len(s.events))
+	}
+	visit(0, s.next)
+
+	return events
+}
+
+// Handler returns a Hertz handler serving the kept events as JSON, oldest
+// first. Events are selected by the query arguments ParseEventFilter reads,
+// and limit keeps only the newest ones.
+func (s *RingSink) Handler() app.HandlerFunc {
+	return func(c context.Context, ctx *app.RequestContext) {
+		filter, err := ParseEventFilter(ctx.QueryArgs())
+		if err != nil {
+			ctx.AbortWithMsg(err.Error(), consts.StatusBadRequest)
+			return
+		}
+
+		events := s.Events(filter)
+		if v := ctx.Query("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 0 {
+				ctx.AbortWithMsg("invalid limit: "+v, consts.StatusBadRequest)
+				return
+			}
+			if len(events) > limit {
+				events = events[len(events)-limit:]
+			}
+		}
+
+		records := make([]jsonEvent, len(events))
+		for i := range events {
+			records[i] = newJSONEvent(&events[i])
+		}
+		ctx.JSON(consts.StatusOK, records)
+	}
+}
@@ -0,0 +1,77 @@
+package accessLog
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRingSink(t *testing.T) {
+	sink := NewRingSink(3)
+	assert.Empty(t, sink.Events(EventFilter{}))
+
+	for i := 1; i <= 5; i++ {
+		sink.Emit(context.Background(), LogFormatterParams{StatusCode: 200 + i})
+	}
+
+	var statuses []int
+	for _, e := range sink.Events(EventFilter{}) {
+		statuses = append(statuses, e.StatusCode)
+	}
+	assert.Equal(t, []int{203, 204, 205}, statuses)
+
+	events := sink.Events(EventFilter{MinStatus: 204})
+	assert.Len(t, events, 2)
+}
+
+func TestRingSinkHandler(t *testing.T) {
+	sink := NewRingSink(10)
+
+	router := route.NewEngine(config.NewOptions([]config.Option{}))
+	router.Use(LoggerWithConfig(LoggerConfig{Sink: sink, SkipPaths: []string{"/debug/accesslog"}}))
+	router.GET("/debug/accesslog", sink.Handler())
+	router.GET("/example", func(c context.Context, ctx *app.RequestContext) {})
+	router.POST("/example", func(c context.Context, ctx *app.RequestContext) {
+		time.Sleep(5 * time.Millisecond)
+	})
+
+	_ = ut.PerformRequest(router, "GET", "/example", nil)
+	_ = ut.PerformRequest(router, "POST", "/example", nil)
+	_ = ut.PerformRequest(router, "GET", "/notfound", nil)
+	_ = ut.PerformRequest(router, "GET", "/example?a=1", nil)
+
+	query := func(url string) []map[string]any {
+		w := ut.PerformRequest(router, "GET", url, nil)
+		assert.Equal(t, 200, w.Code)
+		var events []map[string]any
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &events))
+		return events
+	}
+
+	events := query("/debug/accesslog")
+	assert.Len(t, events, 4)
+	assert.Equal(t, "/example", events[0]["path"])
+	assert.Equal(t, "/example?a=1", events[3]["path"])
+
+	events = query("/debug/accesslog?status=4xx")
+	assert.Len(t, events, 1)
+	assert.Equal(t, float64(404), events[0]["status"])
+
+	assert.Len(t, query("/debug/accesslog?method=POST&min_latency=5ms"), 1)
+	assert.Len(t, query("/debug/accesslog?path_prefix=/example&method=GET"), 2)
+	assert.Len(t, query("/debug/accesslog?since=1m"), 4)
+	assert.Empty(t, query("/debug/accesslog?client_ip=9.9.9.9"))
+
+	events = query("/debug/accesslog?limit=1")
+	assert.Len(t, events, 1)
+	assert.Equal(t, "/example?a=1", events[0]["path"])
+
+	w := ut.PerformRequest(router, "GET", "/debug/accesslog?status=bad", nil)
+	assert.Equal(t, 400, w.Code)
+}
@@ -0,0 +1,355 @@
+package accessLog
+
+import (
+	"context"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SLO declares a service level objective over the requests of a route pattern.
+// A request is bad when it fails with a 5xx status or a panic, or when it is
+// slower than LatencyTarget.
+type SLO struct {
+	// Name identifies the SLO in the status and the burn events.
+	Name string
+
+	// Route is the route template the SLO covers, a prefix when it ends with *,
+	// such as /api/*. Empty covers every request.
+	Route string
+
+	// Method restricts the SLO to one HTTP method.
+	// Optional. Default value is "", every method.
+	Method string
+
+	// Objective is the fraction of good requests targeted, such as 0.999.
+	Objective float64
+
+	// LatencyTarget counts the requests slower than it as bad.
+	// Optional. Default value is 0, latency is not part of the SLO.
+	LatencyTarget time.Duration
+}
+
+// BurnAlert is a multi-window burn-rate threshold: it fires when the error
+// budget burns at least Rate times faster than sustainable over both the Long
+// and the Short window.
+type BurnAlert struct {
+	Long  time.Duration
+	Short time.Duration
+	Rate  float64
+}
+
+// BurnEvent reports a BurnAlert of an SLO starting or ceasing to fire.
+type BurnEvent struct {
+	SLO       string
+	Alert     BurnAlert
+	LongRate  float64
+	ShortRate float64
+	Firing    bool
+	Time      time.Time
+}
+
+// SLOConfig defines the config for SLOTracker.
+type SLOConfig struct {
+	// SLOs are the objectives tracked. A request counts towards each SLO it matches.
+	SLOs []SLO
+
+	// Period is the period of the error budget.
+	// Optional. Default value is 30 days.
+	Period time.Duration
+
+	// Alerts are the burn-rate thresholds evaluated for every SLO.
+	// Optional. Default value is DefaultBurnAlerts.
+	Alerts []BurnAlert
+
+	// OnBurn is called when an alert starts or ceases to fire.
+	// Optional. Default value is nil.
+	OnBurn func(e BurnEvent)
+}
+
+// DefaultBurnAlerts page on a 2% budget burn in 1 hour and a 5% burn in 6 hours
+// of a 30 days period.
+var DefaultBurnAlerts = []BurnAlert{
+	{Long: time.Hour, Short: 5 * time.Minute, Rate: 14.4},
+	{Long: 6 * time.Hour, Short: 30 * time.Minute, Rate: 6},
+}
+
+const (
+	// sloResolution is the bucket size of the burn-rate windows.
+	sloResolution = time.Minute
+	// sloPeriodBuckets is the number of buckets of the budget period.
+	sloPeriodBuckets = 720
+)
+
+// BurnRate is the burn rate of an error budget over a window.
+type BurnRate struct {
+	Window time.Duration `json:"window"`
+	Rate   float64       `json:"rate"`
+}
+
+// SLOStatus is the state of an SLO over its budget period.
+type SLOStatus struct {
+	Name      string  `json:"name"`
+	Objective float64 `json:"objective"`
+	Good      uint64  `json:"good"`
+	Bad       uint64  `json:"bad"`
+	// Budget is the fraction of the error budget remaining, negative once exhausted.
+	Budget    float64    `json:"budget"`
+	BurnRates []BurnRate `json:"burn_rates"`
+	// Firing are the alerts currently firing.
+	Firing []BurnAlert `json:"firing"`
+}
+
+// SLOTracker is a Sink counting good and bad requests against SLOs, and
+// reporting their error budget and burn rates.
+type SLOTracker struct {
+	conf    SLOConfig
+	windows []time.Duration
+	slos    []*sloState
+}
+
+type sloState struct {
+	SLO
+
+	mu     sync.Mutex
+	fine   counterRing
+	period counterRing
+	firing []bool
+}
+
+// NewSLOTracker instance a SLOTracker with config.
+func NewSLOTracker(conf SLOConfig) *SLOTracker {
+	if conf.Period <= 0 {
+		conf.Period = 30 * 24 * time.Hour
+	}
+	if conf.Alerts == nil {
+		conf.Alerts = DefaultBurnAlerts
+	}
+
+	t := &SLOTracker{conf: conf}
+
+	var longest time.Duration
+	seen := make(map[time.Duration]bool)
+	for _, a := range conf.Alerts {
+		for _, w := range []time.Duration{a.Long, a.Short} {
+			if !seen[w] {
+				seen[w] = true
+				t.windows = append(t.windows, w)
+			}
+			if w > longest {
+				longest = w
+			}
+		}
+	}
+
+	periodRes := conf.Period / sloPeriodBuckets
+	if periodRes < sloResolution {
+		periodRes = sloResolution
+	}
+	for _, slo := range conf.SLOs {
+		t.slos = append(t.slos, &sloState{
+			SLO:    slo,
+			fine:   newCounterRing(sloResolution, longest),
+			period: newCounterRing(periodRes, conf.Period),
+			firing: make([]bool, len(conf.Alerts)),
+		})
+	}
+	return t
+}
+
+// Emit implements Sink. Events of requests still running and the final
+// events of hijacked connections are not counted.
+func (t *SLOTracker) Emit(_ context.Context, param LogFormatterParams) {
+	if param.InFlight || param.Hijacked {
+		return
+	}
+
+	ts := param.TimeStamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	var events []BurnEvent
+	for _, s := range t.slos {
+		if !s.match(&param) {
+			continue
+		}
+		bad := param.Level() == hlog.LevelError || (s.LatencyTarget > 0 && param.Latency > s.LatencyTarget)
+
+		s.mu.Lock()
+		s.fine.add(ts, bad)
+		s.period.add(ts, bad)
+		// only a bad event can start an alert, and a firing alert is checked on
+		// every event, so that it clears as soon as it should
+		if bad || s.anyFiring() {
+			events = append(events, t.evaluate(s, ts)...)
+		}
+		s.mu.Unlock()
+	}
+
+	if t.conf.OnBurn != nil {
+		for _, e := range events {
+			t.conf.OnBurn(e)
+		}
+	}
+}
+
+func (s *sloState) anyFiring() bool {
+	for _, firing := range s.firing {
+		if firing {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *sloState) match(param *LogFormatterParams) bool {
+	if s.Method != "" && s.Method != param.Method {
+		return false
+	}
+	if s.Route == "" || s.Route == param.Route {
+		return true
+	}
+	if prefix := strings.TrimSuffix(s.Route, "*"); prefix != s.Route {
+		return strings.HasPrefix(param.Route, prefix)
+	}
+	return false
+}
+
+// evaluate updates the alerts of s at now, returning their transitions. s.mu is held.
+func (t *SLOTracker) evaluate(s *sloState, now time.Time) []BurnEvent {
+	var events []BurnEvent
+	for i, a := range t.conf.Alerts {
+		long := s.burnRate(s.fine.sum(now, a.Long))
+		short := s.burnRate(s.fine.sum(now, a.Short))
+		firing := long >= a.Rate && short >= a.Rate
+		if firing != s.firing[i] {
+			s.firing[i] = firing
+			events = append(events, BurnEvent{
+				SLO:       s.Name,
+				Alert:     a,
+				LongRate:  long,
+				ShortRate: short,
+				Firing:    firing,
+				Time:      now,
+			})
+		}
+	}
+	return events
+}
+
+// burnRate returns how many times faster than sustainable the budget burns for c.
+func (s *sloState) burnRate(c sloCount) float64 {
+	total := c.good + c.bad
+	if total == 0 || s.Objective >= 1 {
+		return 0
+	}
+	return float64(c.bad) / float64(total) / (1 - s.Objective)
+}
+
+// Status returns the state of every SLO, in the configured order. The alerts
+// are evaluated first, so that they clear once traffic stops; their
+// transitions are reported to OnBurn.
+func (t *SLOTracker) Status() []SLOStatus {
+	now := time.Now()
+	statuses := make([]SLOStatus, 0, len(t.slos))
+	var events []BurnEvent
+	for _, s := range t.slos {
+		s.mu.Lock()
+		events = append(events, t.evaluate(s, now)...)
+		c := s.period.sum(now, t.conf.Period)
+		st := SLOStatus{
+			Name:      s.Name,
+			Objective: s.Objective,
+			Good:      c.good,
+			Bad:       c.bad,
+			Budget:    1,
+			BurnRates: make([]BurnRate, 0, len(t.windows)),
+			Firing:    make([]BurnAlert, 0),
+		}
+		if allowed := float64(c.good+c.bad) * (1 - s.Objective); allowed > 0 {
+			st.Budget = 1 - float64(c.bad)/allowed
+		}
+		for _, w := range t.windows {
+			st.BurnRates = append(st.BurnRates, BurnRate{Window: w, Rate: s.burnRate(s.fine.sum(now, w))})
+		}
+		for i, a := range t.conf.Alerts {
+			if s.firing[i] {
+				st.Firing = append(st.Firing, a)
+			}
+		}
+		s.mu.Unlock()
+		statuses = append(statuses, st)
+	}
+
+	if t.conf.OnBurn != nil {
+		for _, e := range events {
+			t.conf.OnBurn(e)
+		}
+	}
+	return statuses
+}
+
+// Handler returns a Hertz handler serving the state of every SLO as JSON.
+func (t *SLOTracker) Handler() app.HandlerFunc {
+	return func(c context.Context, ctx *app.RequestContext) {
+		ctx.JSON(consts.StatusOK, t.Status())
+	}
+}
+
+type sloCount struct {
+	good uint64
+	bad  uint64
+}
+
+// counterRing counts good and bad events in time buckets of res, covering span.
+type counterRing struct {
+	res     time.Duration
+	epochs  []int64
+	buckets []sloCount
+}
+
+func newCounterRing(res, span time.Duration) counterRing {
+	n := int((span + res - 1) / res)
+	if n < 1 {
+		n = 1
+	}
+	return counterRing{res: res, epochs: make([]int64, n), buckets: make([]sloCount, n)}
+}
+
+func (r *counterRing) add(ts time.Time, bad bool) {
+	epoch := ts.UnixNano() / int64(r.res)
+	i := epoch % int64(len(r.buckets))
+	if r.epochs[i] != epoch {
+		if r.epochs[i] > epoch {
+			// the event is older than the span
+			return
+		}
+		r.epochs[i] = epoch
+		r.buckets[i] = sloCount{}
+	}
+	if bad {
+		r.buckets[i].bad++
+	} else {
+		r.buckets[i].good++
+	}
+}
+
+// sum returns the counts of the buckets within window before now.
+func (r *counterRing) sum(now time.Time, window time.Duration) sloCount {
+	current := now.UnixNano() / int64(r.res)
+	n := int64((window + r.res - 1) / r.res)
+
+	var c sloCount
+	for i, epoch := range r.epochs {
+		if epoch <= current-n || epoch > current {
+			continue
+		}
+		c.good += r.buckets[i].good
+		c.bad += r.buckets[i].bad
+	}
+	return c
+}
@@ -0,0 +1,116 @@
+package accessLog
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSLOTracker(t *testing.T) {
+	var events []BurnEvent
+	alert := BurnAlert{Long: 10 * time.Minute, Short: time.Minute, Rate: 10}
+	tracker := NewSLOTracker(SLOConfig{
+		SLOs: []SLO{
+			{Name: "checkout", Route: "/checkout", Objective: 0.99},
+			{Name: "api-latency", Route: "/api/*", Method: "GET", Objective: 0.9, LatencyTarget: 100 * time.Millisecond},
+		},
+		Alerts: []BurnAlert{alert},
+		OnBurn: func(e BurnEvent) { events = append(events, e) },
+	})
+
+	// every event of the short window falls in the same bucket
+	t0 := time.Now().Truncate(sloResolution).Add(-2 * sloResolution)
+	emit := func(ts time.Time, n int, param LogFormatterParams) {
+		param.TimeStamp = ts
+		for i := 0; i < n; i++ {
+			tracker.Emit(context.Background(), param)
+		}
+	}
+
+	emit(t0, 90, LogFormatterParams{Route: "/checkout", StatusCode: 200})
+	assert.Empty(t, events)
+
+	// the alert fires during the burst, without waiting for another event
+	emit(t0.Add(2*time.Second), 20, LogFormatterParams{Route: "/checkout", StatusCode: 503})
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, "checkout", events[0].SLO)
+		assert.Equal(t, alert, events[0].Alert)
+		assert.True(t, events[0].Firing)
+		assert.InDelta(t, 11.0/101/0.01, events[0].LongRate, 1e-9)
+	}
+
+	emit(t0.Add(4*time.Second), 1, LogFormatterParams{Route: "/checkout", StatusCode: 200})
+	assert.Len(t, events, 1)
+
+	emit(t0.Add(30*time.Second), 2000, LogFormatterParams{Route: "/checkout", StatusCode: 200})
+	if assert.Len(t, events, 2) {
+		assert.False(t, events[1].Firing)
+	}
+
+	emit(t0, 3, LogFormatterParams{Method: "GET", Route: "/api/users", StatusCode: 200, Latency: time.Millisecond})
+	emit(t0, 1, LogFormatterParams{Method: "GET", Route: "/api/users", StatusCode: 200, Latency: time.Second})
+	emit(t0, 5, LogFormatterParams{Method: "POST", Route: "/api/users", StatusCode: 500})
+	emit(t0, 5, LogFormatterParams{Method: "GET", Route: "/other", StatusCode: 500})
+
+	statuses := tracker.Status()
+	assert.Len(t, statuses, 2)
+
+	assert.Equal(t, "checkout", statuses[0].Name)
+	assert.Equal(t, uint64(2091), statuses[0].Good)
+	assert.Equal(t, uint64(20), statuses[0].Bad)
+	assert.InDelta(t, 1-20/(2111*0.01), statuses[0].Budget, 1e-9)
+	assert.Empty(t, statuses[0].Firing)
+	assert.Len(t, statuses[0].BurnRates, 2)
+
+	assert.Equal(t, uint64(3), statuses[1].Good)
+	assert.Equal(t, uint64(1), statuses[1].Bad)
+	assert.InDelta(t, 1-1/(4*0.1), statuses[1].Budget, 1e-9)
+}
+
+func TestSLOTrackerHandler(t *testing.T) {
+	tracker := NewSLOTracker(SLOConfig{SLOs: []SLO{{Name: "all", Objective: 0.5}}})
+
+	router := route.NewEngine(config.NewOptions([]config.Option{}))
+	router.Use(LoggerWithConfig(LoggerConfig{Sink: tracker, SkipPaths: []string{"/debug/slo"}}))
+	router.GET("/debug/slo", tracker.Handler())
+	router.GET("/example", func(c context.Context, ctx *app.RequestContext) {})
+
+	_ = ut.PerformRequest(router, "GET", "/example", nil)
+	_ = ut.PerformRequest(router, "GET", "/notfound", nil)
+
+	w := ut.PerformRequest(router, "GET", "/debug/slo", nil)
+	assert.Equal(t, 200, w.Code)
+	var statuses []SLOStatus
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &statuses))
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, uint64(2), statuses[0].Good)
+	assert.Equal(t, 1.0, statuses[0].Budget)
+	assert.Len(t, statuses[0].BurnRates, 4)
+}
+
+func TestSLOTrackerClearsWithoutTraffic(t *testing.T) {
+	var events []BurnEvent
+	tracker := NewSLOTracker(SLOConfig{
+		SLOs:   []SLO{{Name: "checkout", Route: "/checkout", Objective: 0.99}},
+		Alerts: []BurnAlert{{Long: 10 * time.Minute, Short: time.Minute, Rate: 10}},
+		OnBurn: func(e BurnEvent) { events = append(events, e) },
+	})
+
+	// the last event is older than the short window
+	tracker.Emit(context.Background(), LogFormatterParams{Route: "/checkout", StatusCode: 503, TimeStamp: time.Now().Add(-5 * time.Minute)})
+	if assert.Len(t, events, 1) {
+		assert.True(t, events[0].Firing)
+	}
+
+	statuses := tracker.Status()
+	assert.Empty(t, statuses[0].Firing)
+	if assert.Len(t, events, 2) {
+		assert.False(t, events[1].Firing)
+	}
+}
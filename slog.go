@@ -0,0 +1,209 @@
+//go:build go1.21
+
+package accessLog
+
+import (
+	"context"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"log/slog"
+	"strings"
+)
+
+// SlogConfig defines the config for SlogSink.
+type SlogConfig struct {
+	// Logger is the logger the records are emitted on.
+	// Optional. Default value is slog.Default().
+	Logger *slog.Logger
+
+	// Headers are the request headers logged, case-insensitive.
+	// Optional. Default value is nil, every header is logged with the values
+	// of the credentials redacted: Authorization, Cookie and the headers
+	// whose name mentions a token, secret, password or API key.
+	Headers []string
+}
+
+// SlogSink emits access events as slog records carrying every param as a typed attribute.
+type SlogSink struct {
+	logger  *slog.Logger
+	headers map[string]struct{}
+}
+
+// redacted replaces the value of a sensitive header.
+const redacted = "[REDACTED]"
+
+// sensitiveHeaders are the headers redacted by default, lower case.
+var sensitiveHeaders = map[string]struct{}{
+	"authorization":       {},
+	"proxy-authorization": {},
+	"cookie":              {},
+	"set-cookie":          {},
+}
+
+// NewSlogSink instance a SlogSink writing to the specified logger.
+// Optional. Default value is slog.Default().
+func NewSlogSink(logger *slog.Logger) *SlogSink {
+	return NewSlogSinkWithConfig(SlogConfig{Logger: logger})
+}
+
+// NewSlogSinkWithConfig instance a SlogSink with config.
+func NewSlogSinkWithConfig(conf SlogConfig) *SlogSink {
+	s := &SlogSink{logger: conf.Logger}
+	if s.logger == nil {
+		s.logger = slog.Default()
+	}
+	if conf.Headers != nil {
+		s.headers = make(map[string]struct{}, len(conf.Headers))
+		for _, h := range conf.Headers {
+			s.headers[strings.ToLower(h)] = struct{}{}
+		}
+	}
+	return s
+}
+
+// Emit implements Sink. The request context is handed to the slog handler
+// so it can pull trace data out of it.
+func (s *SlogSink) Emit(c context.Context, param LogFormatterParams) {
+	level := slogLevel(param.Level())
+	if !s.logger.Enabled(c, level) {
+		return
+	}
+
+	r := slog.NewRecord(param.TimeStamp, level, "access", 0)
+	r.AddAttrs(s.attrs(param)...)
+	_ = s.logger.Handler().Handle(c, r)
+}
+
+// LoggerWithSlog instance a Logger middleware that emits access events on the specified slog logger.
+func LoggerWithSlog(logger *slog.Logger, notLogged ...string) app.HandlerFunc {
+	return LoggerWithConfig(LoggerConfig{
+		Sink:      NewSlogSink(logger),
+		SkipPaths: notLogged,
+	})
+}
+
+// slogLevel maps an hlog level to the closest slog level.
+func slogLevel(level hlog.Level) slog.Level {
+	switch {
+	case level >= hlog.LevelError:
+		return slog.LevelError
+	case level >= hlog.LevelWarn:
+		return slog.LevelWarn
+	case level >= hlog.LevelInfo:
+		return slog.LevelInfo
+	default:
+		return slog.LevelDebug
+	}
+}
+
+// attrs converts param into slog attributes.
+func (s *SlogSink) attrs(param LogFormatterParams) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.Int("status", param.StatusCode),
+		slog.String("method", param.Method),
+		slog.String("path", param.Path),
+		slog.String("route", param.Route),
+		slog.String("host", param.Host),
+		slog.String("client_ip", param.ClientIP),
+		slog.Duration("latency", param.Latency),
+		slog.Int("body_size", param.BodySize),
+		slog.Int("content_length", param.ContentLength),
+		slog.Int("request_body_size", param.RequestBodySize),
+		slog.Int("request_content_length", param.RequestContentLength),
+		slog.Int("request_header_size", param.RequestHeaderSize),
+		slog.String("proto", param.Proto),
+		slog.String("scheme", param.Scheme),
+		slog.String("remote_ip", param.RemoteIP),
+		slog.Int("remote_port", param.RemotePort),
+		slog.String("local_addr", param.LocalAddr),
+	}
+
+	if param.TLSVersion != "" {
+		attrs = append(attrs, slog.Group("tls",
+			slog.String("version", param.TLSVersion),
+			slog.String("cipher_suite", param.TLSCipherSuite),
+		))
+	}
+
+	if param.ServerLatency > 0 {
+		attrs = append(attrs, slog.Group("phases",
+			slog.Duration("read_header", param.ReadHeaderLatency),
+			slog.Duration("read_body", param.ReadBodyLatency),
+			slog.Duration("handle", param.HandleLatency),
+			slog.Duration("write", param.WriteLatency),
+			slog.Duration("server", param.ServerLatency),
+		))
+	}
+
+	if param.Hijacked {
+		attrs = append(attrs,
+			slog.Bool("hijacked", true),
+			slog.Int64("conn_bytes_read", param.ConnBytesRead),
+			slog.Int64("conn_bytes_written", param.ConnBytesWritten),
+		)
+	}
+
+	if param.ErrorMessage != "" {
+		attrs = append(attrs, slog.String("error", param.ErrorMessage))
+	}
+
+	if param.InFlight {
+		attrs = append(attrs, slog.Bool("in_flight", true))
+	}
+
+	if param.Slow {
+		attrs = append(attrs, slog.Bool("slow", true))
+	}
+
+	if param.ServerError != nil {
+		attrs = append(attrs, slog.String("server_error", param.ServerError.Error()))
+	}
+
+	if param.Panic != nil {
+		attrs = append(attrs, slog.Any("panic", param.Panic), slog.String("stack", param.Stack))
+	}
+
+	if param.Request != nil {
+		var headers []any
+		param.Request.Header.VisitAll(func(key, value []byte) {
+			name := strings.ToLower(string(key))
+			if s.headers != nil {
+				if _, ok := s.headers[name]; ok {
+					headers = append(headers, slog.String(string(key), string(value)))
+				}
+				return
+			}
+			if isSensitiveHeader(name) {
+				headers = append(headers, slog.String(string(key), redacted))
+				return
+			}
+			headers = append(headers, slog.String(string(key), string(value)))
+		})
+		if len(headers) > 0 {
+			attrs = append(attrs, slog.Group("headers", headers...))
+		}
+	}
+
+	if len(param.Keys) > 0 {
+		keys := make([]any, 0, len(param.Keys))
+		for k, v := range param.Keys {
+			keys = append(keys, slog.Any(k, v))
+		}
+		attrs = append(attrs, slog.Group("keys", keys...))
+	}
+
+	return attrs
+}
+
+// isSensitiveHeader reports whether the header name, in lower case, carries credentials.
+func isSensitiveHeader(name string) bool {
+	if _, ok := sensitiveHeaders[name]; ok {
+		return true
+	}
+	for _, word := range []string{"token", "secret", "password", "api-key", "apikey"} {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+//go:build go1.21
+
+package accessLog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+type traceKey struct{}
+
+// traceHandler copies a trace id stored in the context onto every record.
+type traceHandler struct {
+	slog.Handler
+}
+
+func (h traceHandler) Handle(c context.Context, r slog.Record) error {
+	if id, ok := c.Value(traceKey{}).(string); ok {
+		r.AddAttrs(slog.String("trace_id", id))
+	}
+	return h.Handler.Handle(c, r)
+}
+
+func TestLoggerWithSlog(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	logger := slog.New(slog.NewJSONHandler(buffer, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	router := route.NewEngine(config.NewOptions([]config.Option{}))
+	router.Use(func(c context.Context, ctx *app.RequestContext) {
+		ctx.Next(context.WithValue(c, traceKey{}, "abc"))
+	})
+	router.Use(LoggerWithSlog(slog.New(traceHandler{logger.Handler()})))
+	router.GET("/example", func(c context.Context, ctx *app.RequestContext) {
+		ctx.Set("user", "alice")
+		time.Sleep(time.Millisecond)
+	})
+	router.GET("/fail", func(c context.Context, ctx *app.RequestContext) {
+		ctx.AbortWithStatus(503)
+	})
+
+	_ = ut.PerformRequest(router, "GET", "/example?a=100", nil,
+		ut.Header{Key: "X-Test", Value: "yes"},
+		ut.Header{Key: "Authorization", Value: "Bearer secret"},
+		ut.Header{Key: "X-Api-Key", Value: "secret"})
+
+	var record map[string]any
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &record))
+	assert.Equal(t, "INFO", record["level"])
+	assert.Equal(t, "access", record["msg"])
+	assert.Equal(t, float64(200), record["status"])
+	assert.Equal(t, "GET", record["method"])
+	assert.Equal(t, "/example?a=100", record["path"])
+	assert.GreaterOrEqual(t, record["latency"], float64(time.Millisecond))
+	headers := record["headers"].(map[string]any)
+	assert.Equal(t, "yes", headers["X-Test"])
+	assert.Equal(t, "[REDACTED]", headers["Authorization"])
+	assert.Equal(t, "[REDACTED]", headers["X-Api-Key"])
+	assert.Equal(t, "alice", record["keys"].(map[string]any)["user"])
+	assert.Equal(t, "abc", record["trace_id"])
+
+	buffer.Reset()
+	_ = ut.PerformRequest(router, "GET", "/fail", nil)
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &record))
+	assert.Equal(t, "ERROR", record["level"])
+	assert.Equal(t, float64(503), record["status"])
+}
+
+func TestSlogSinkLevel(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	sink := NewSlogSink(slog.New(slog.NewTextHandler(buffer, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	sink.Emit(context.Background(), LogFormatterParams{StatusCode: 200})
+	assert.Empty(t, buffer.String())
+
+	sink.Emit(context.Background(), LogFormatterParams{StatusCode: 404})
+	assert.Contains(t, buffer.String(), "level=WARN")
+	assert.Contains(t, buffer.String(), "status=404")
+}
+
+func TestSlogSinkHeaders(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	router := route.NewEngine(config.NewOptions([]config.Option{}))
+	router.Use(LoggerWithConfig(LoggerConfig{Sink: NewSlogSinkWithConfig(SlogConfig{
+		Logger:  slog.New(slog.NewJSONHandler(buffer, nil)),
+		Headers: []string{"x-request-id"},
+	})}))
+	router.GET("/example", func(c context.Context, ctx *app.RequestContext) {})
+
+	_ = ut.PerformRequest(router, "GET", "/example", nil,
+		ut.Header{Key: "X-Request-ID", Value: "42"},
+		ut.Header{Key: "Cookie", Value: "session=secret"})
+
+	var record map[string]any
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &record))
+	assert.Equal(t, map[string]any{"X-Request-Id": "42"}, record["headers"])
+}
@@ -0,0 +1,67 @@
+package accessLog
+
+import (
+	"encoding/binary"
+)
+
+// snappyEncode compresses src in the snappy block format, as required by the
+// Loki and Prometheus remote protocols, without depending on a snappy library.
+// It finds matches with a single hash table probe, trading ratio for simplicity.
+func snappyEncode(src []byte) []byte {
+	dst := binary.AppendUvarint(make([]byte, 0, len(src)/2+16), uint64(len(src)))
+
+	var table [1 << 14]int32 // positions + 1 of the last occurrence of each hashed 4 bytes
+	lit := 0
+	for i := 0; i+4 <= len(src); {
+		v := binary.LittleEndian.Uint32(src[i:])
+		h := (v * 0x1e35a7bd) >> 18
+		cand := int(table[h]) - 1
+		table[h] = int32(i + 1)
+
+		if cand < 0 || i-cand > 0xffff || binary.LittleEndian.Uint32(src[cand:]) != v {
+			i++
+			continue
+		}
+
+		n := 4
+		for i+n < len(src) && src[cand+n] == src[i+n] {
+			n++
+		}
+		dst = appendSnappyLiteral(dst, src[lit:i])
+		dst = appendSnappyCopy(dst, i-cand, n)
+		i += n
+		lit = i
+	}
+	return appendSnappyLiteral(dst, src[lit:])
+}
+
+func appendSnappyLiteral(dst, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+	n := len(lit) - 1
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2)
+	case n <= 0xff:
+		dst = append(dst, 60<<2, byte(n))
+	case n <= 0xffff:
+		dst = append(dst, 61<<2, byte(n), byte(n>>8))
+	default:
+		dst = append(dst, 63<<2, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, lit...)
+}
+
+// appendSnappyCopy appends copies of 2 byte offsets, up to 64 bytes each.
+func appendSnappyCopy(dst []byte, offset, n int) []byte {
+	for n > 0 {
+		l := n
+		if l > 64 {
+			l = 64
+		}
+		dst = append(dst, byte(l-1)<<2|2, byte(offset), byte(offset>>8))
+		n -= l
+	}
+	return dst
+}
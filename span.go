@@ -0,0 +1,440 @@
+package accessLog
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SpanFormat is the wire format of exported spans.
+type SpanFormat string
+
+const (
+	// SpanOTLP exports spans over OTLP/HTTP.
+	SpanOTLP SpanFormat = "otlp"
+	// SpanZipkin exports spans as Zipkin v2 JSON.
+	SpanZipkin SpanFormat = "zipkin"
+)
+
+// SpanConfig defines the config for SpanExporter.
+type SpanConfig struct {
+	// Format is the wire format of the spans.
+	// Optional. Default value is SpanOTLP.
+	Format SpanFormat
+
+	// Endpoint is the URL the spans are posted to.
+	// Optional. Default value is "http://localhost:4318/v1/traces" for OTLP
+	// and "http://localhost:9411/api/v2/spans" for Zipkin.
+	Endpoint string
+
+	// Encoding is the payload encoding of OTLP exports.
+	// Optional. Default value is OTLPProtobuf.
+	Encoding OTLPEncoding
+
+	// ServiceName is the name of the service the spans belong to.
+	// Optional. Default value is the service.name of Resource, or unknown_service.
+	ServiceName string
+
+	// Resource are the attributes of the resource producing the OTLP spans.
+	// Optional. Default value is nil.
+	Resource map[string]string
+
+	// Headers are added to every export request.
+	// Optional. Default value is nil.
+	Headers map[string]string
+
+	// Timeout is the timeout of an export request.
+	// Optional. Default value is 10 seconds.
+	Timeout time.Duration
+
+	// Batch defines how spans are batched and retried.
+	Batch BatchConfig
+
+	// ErrorHandler is called with the errors of the batches dropped.
+	// Optional. Default value is nil, errors are dropped.
+	ErrorHandler func(err error)
+}
+
+// SpanExporter is a Sink turning access events into SERVER spans. A request
+// carrying a traceparent header joins the caller's trace, and is not exported
+// when the caller did not sample it; other requests start a new trace.
+type SpanExporter struct {
+	conf     SpanConfig
+	client   *http.Client
+	header   http.Header
+	resource []otlpAttr
+	batcher  *batcher[span]
+}
+
+// span is a SERVER span ready to be encoded.
+type span struct {
+	traceID    [16]byte
+	spanID     [8]byte
+	parentID   [8]byte
+	hasParent  bool
+	traceState string
+	flags      byte
+	name       string
+	start      time.Time
+	end        time.Time
+	isError    bool
+	attrs      []otlpAttr
+	zipkinTags map[string]string
+	remoteIP   string
+	remotePort int
+}
+
+// NewSpanExporter instance a SpanExporter with config.
+func NewSpanExporter(conf SpanConfig) *SpanExporter {
+	if conf.Format == "" {
+		conf.Format = SpanOTLP
+	}
+	if conf.Endpoint == "" {
+		if conf.Format == SpanZipkin {
+			conf.Endpoint = "http://localhost:9411/api/v2/spans"
+		} else {
+			conf.Endpoint = "http://localhost:4318/v1/traces"
+		}
+	}
+	if conf.Encoding == "" {
+		conf.Encoding = OTLPProtobuf
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 10 * time.Second
+	}
+	resource := make(map[string]string, len(conf.Resource)+1)
+	for k, v := range conf.Resource {
+		resource[k] = v
+	}
+	if conf.ServiceName != "" {
+		resource["service.name"] = conf.ServiceName
+	} else if name, ok := resource["service.name"]; ok {
+		conf.ServiceName = name
+	} else {
+		conf.ServiceName = "unknown_service"
+	}
+	conf.Batch = conf.Batch.withDefaults()
+
+	e := &SpanExporter{
+		conf:     conf,
+		client:   &http.Client{Timeout: conf.Timeout},
+		resource: otlpResource(resource),
+	}
+	if conf.Format == SpanZipkin {
+		e.header = otlpHeader(OTLPJSON, conf.Headers)
+	} else {
+		e.header = otlpHeader(conf.Encoding, conf.Headers)
+	}
+	e.batcher = newBatcher(conf.Batch, e.export)
+	return e
+}
+
+// Emit implements Sink. Events of requests still running and the final
+// events of hijacked connections, whose request was already exported, are not
+// exported.
+func (e *SpanExporter) Emit(_ context.Context, param LogFormatterParams) {
+	if param.InFlight || param.Hijacked {
+		return
+	}
+	if s, ok := newSpan(&param); ok {
+		e.batcher.add(s)
+	}
+}
+
+// Dropped returns the number of spans dropped because the queue was full.
+func (e *SpanExporter) Dropped() uint64 {
+	return e.batcher.dropped()
+}
+
+// Close exports the queued spans and stops the exporter.
+func (e *SpanExporter) Close() error {
+	e.batcher.close()
+	return nil
+}
+
+// EmitBatch implements BatchSink, exporting the spans of params at once.
+func (e *SpanExporter) EmitBatch(c context.Context, params []LogFormatterParams) error {
+	spans := make([]span, 0, len(params))
+	for i := range params {
+		if params[i].InFlight || params[i].Hijacked {
+			continue
+		}
+		if s, ok := newSpan(&params[i]); ok {
+			spans = append(spans, s)
+		}
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	return e.send(c, spans)
+}
+
+func (e *SpanExporter) export(c context.Context, spans []span) {
+	if err := e.send(c, spans); err != nil && e.conf.ErrorHandler != nil {
+		e.conf.ErrorHandler(err)
+	}
+}
+
+// send posts spans, retrying as configured until c is done.
+func (e *SpanExporter) send(c context.Context, spans []span) error {
+	var body []byte
+	retryable := otlpRetryable
+	switch {
+	case e.conf.Format == SpanZipkin:
+		body = encodeZipkinSpans(e.conf.ServiceName, spans)
+		retryable = func(code int) bool { return code == http.StatusTooManyRequests || code >= 500 }
+	case e.conf.Encoding == OTLPJSON:
+		body = encodeOTLPSpansJSON(e.resource, spans)
+	default:
+		body = encodeOTLPSpansProto(e.resource, spans)
+	}
+
+	return e.conf.Batch.retry(c, func() error {
+		return postBatch(e.client, e.conf.Endpoint, e.header, body, retryable)
+	})
+}
+
+// newSpan returns the span of param, false when the caller did not sample it.
+func newSpan(param *LogFormatterParams) (span, bool) {
+	s := span{
+		name:       param.Method,
+		end:        param.TimeStamp,
+		isError:    param.StatusCode >= 500 || param.Panic != nil,
+		attrs:      httpAttrs(param),
+		remoteIP:   param.RemoteIP,
+		remotePort: param.RemotePort,
+	}
+	if s.end.IsZero() {
+		s.end = time.Now()
+	}
+	s.start = s.end.Add(-param.Latency)
+	if param.Route != "" {
+		s.name += " " + param.Route
+	}
+
+	traceID, spanID := spanIDs(param)
+	if tp, ok := requestTraceParent(param.Request); ok {
+		if tp.flags&1 == 0 {
+			return s, false
+		}
+		s.traceID, s.parentID, s.flags, s.hasParent = tp.traceID, tp.spanID, tp.flags, true
+		s.traceState = string(param.Request.Header.Peek("tracestate"))
+	} else {
+		s.traceID, s.flags = traceID, 1
+	}
+	s.spanID = spanID
+
+	path, _, _ := strings.Cut(param.Path, "?")
+	s.zipkinTags = map[string]string{
+		"http.method": param.Method,
+		"http.path":   path,
+	}
+	if param.Route != "" {
+		s.zipkinTags["http.route"] = param.Route
+	}
+	if param.StatusCode != 0 {
+		s.zipkinTags["http.status_code"] = strconv.Itoa(param.StatusCode)
+	}
+	if s.isError {
+		s.zipkinTags["error"] = strconv.Itoa(param.StatusCode)
+	}
+	return s, true
+}
+
+// spanIDs returns the span ID of param, and the trace ID used when it has no
+// parent. They are derived from the event, so that an event delivered again,
+// such as by a DurableQueue, is exported as the same span. Events without
+// TimeStamp get random IDs.
+func spanIDs(param *LogFormatterParams) (traceID [16]byte, spanID [8]byte) {
+	if param.TimeStamp.IsZero() {
+		_, _ = rand.Read(traceID[:])
+		_, _ = rand.Read(spanID[:])
+		return
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%d %d %s %s %s %d %d %d", param.TimeStamp.UnixNano(), param.Latency,
+		param.Method, param.Path, param.RemoteIP, param.RemotePort, param.StatusCode, param.BodySize)
+	if param.Request != nil {
+		h.Write(param.Request.Header.Peek("traceparent"))
+	}
+	sum := h.Sum(nil)
+	copy(traceID[:], sum)
+	copy(spanID[:], sum[len(traceID):])
+	return
+}
+
+// encodeOTLPSpansProto encodes an ExportTraceServiceRequest.
+func encodeOTLPSpansProto(resource []otlpAttr, spans []span) []byte {
+	return appendMessageField(nil, 1, func(b []byte) []byte { // resource_spans
+		b = appendMessageField(b, 1, func(b []byte) []byte { // resource
+			return appendAttrsProto(b, 1, resource)
+		})
+		return appendMessageField(b, 2, func(b []byte) []byte { // scope_spans
+			b = appendMessageField(b, 1, func(b []byte) []byte { // scope
+				return appendStringField(b, 1, otlpScopeName)
+			})
+			for i := range spans {
+				b = appendMessageField(b, 2, spans[i].appendProto) // spans
+			}
+			return b
+		})
+	})
+}
+
+const (
+	otlpSpanKindServer  = 2
+	otlpStatusCodeError = 2
+)
+
+// appendProto appends the Span message of s.
+func (s *span) appendProto(b []byte) []byte {
+	b = appendBytesField(b, 1, s.traceID[:])
+	b = appendBytesField(b, 2, s.spanID[:])
+	b = appendStringField(b, 3, s.traceState)
+	if s.hasParent {
+		b = appendBytesField(b, 4, s.parentID[:])
+	}
+	b = appendStringField(b, 5, s.name)
+	b = appendVarintField(b, 6, otlpSpanKindServer)
+	b = appendFixed64Field(b, 7, uint64(s.start.UnixNano()))
+	b = appendFixed64Field(b, 8, uint64(s.end.UnixNano()))
+	b = appendAttrsProto(b, 9, s.attrs)
+	if s.isError {
+		b = appendMessageField(b, 15, func(b []byte) []byte {
+			return appendVarintField(b, 3, otlpStatusCodeError)
+		})
+	}
+	return appendFixed32Field(b, 16, uint32(s.flags))
+}
+
+type otlpJSONStatus struct {
+	Code int `json:"code,omitempty"`
+}
+
+type otlpJSONSpan struct {
+	TraceID           string             `json:"traceId"`
+	SpanID            string             `json:"spanId"`
+	TraceState        string             `json:"traceState,omitempty"`
+	ParentSpanID      string             `json:"parentSpanId,omitempty"`
+	Flags             uint32             `json:"flags,omitempty"`
+	Name              string             `json:"name"`
+	Kind              int                `json:"kind"`
+	StartTimeUnixNano string             `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string             `json:"endTimeUnixNano"`
+	Attributes        []otlpJSONKeyValue `json:"attributes"`
+	Status            otlpJSONStatus     `json:"status"`
+}
+
+// encodeOTLPSpansJSON encodes an ExportTraceServiceRequest in the JSON mapping.
+func encodeOTLPSpansJSON(resource []otlpAttr, spans []span) []byte {
+	jsonSpans := make([]otlpJSONSpan, 0, len(spans))
+	for i := range spans {
+		s := &spans[i]
+		js := otlpJSONSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			TraceState:        s.traceState,
+			Flags:             uint32(s.flags),
+			Name:              s.name,
+			Kind:              otlpSpanKindServer,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        otlpJSONAttrs(s.attrs),
+		}
+		if s.hasParent {
+			js.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		if s.isError {
+			js.Status.Code = otlpStatusCodeError
+		}
+		jsonSpans = append(jsonSpans, js)
+	}
+
+	type scopeSpans struct {
+		Scope otlpJSONScope  `json:"scope"`
+		Spans []otlpJSONSpan `json:"spans"`
+	}
+	type resourceSpans struct {
+		Resource   otlpJSONResource `json:"resource"`
+		ScopeSpans []scopeSpans     `json:"scopeSpans"`
+	}
+	payload := struct {
+		ResourceSpans []resourceSpans `json:"resourceSpans"`
+	}{
+		ResourceSpans: []resourceSpans{{
+			Resource: otlpJSONResource{Attributes: otlpJSONAttrs(resource)},
+			ScopeSpans: []scopeSpans{{
+				Scope: otlpJSONScope{Name: otlpScopeName},
+				Spans: jsonSpans,
+			}},
+		}},
+	}
+
+	body, _ := json.Marshal(payload)
+	return body
+}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName,omitempty"`
+	IPv4        string `json:"ipv4,omitempty"`
+	IPv6        string `json:"ipv6,omitempty"`
+	Port        int    `json:"port,omitempty"`
+}
+
+type zipkinSpan struct {
+	TraceID        string            `json:"traceId"`
+	ID             string            `json:"id"`
+	ParentID       string            `json:"parentId,omitempty"`
+	Name           string            `json:"name"`
+	Kind           string            `json:"kind"`
+	Timestamp      int64             `json:"timestamp"`
+	Duration       int64             `json:"duration"`
+	LocalEndpoint  zipkinEndpoint    `json:"localEndpoint"`
+	RemoteEndpoint *zipkinEndpoint   `json:"remoteEndpoint,omitempty"`
+	Tags           map[string]string `json:"tags"`
+}
+
+// encodeZipkinSpans encodes spans as a Zipkin v2 JSON array.
+func encodeZipkinSpans(serviceName string, spans []span) []byte {
+	zipkinSpans := make([]zipkinSpan, 0, len(spans))
+	for i := range spans {
+		s := &spans[i]
+		zs := zipkinSpan{
+			TraceID:       hex.EncodeToString(s.traceID[:]),
+			ID:            hex.EncodeToString(s.spanID[:]),
+			Name:          s.name,
+			Kind:          "SERVER",
+			Timestamp:     s.start.UnixMicro(),
+			Duration:      s.end.Sub(s.start).Microseconds(),
+			LocalEndpoint: zipkinEndpoint{ServiceName: serviceName},
+			Tags:          s.zipkinTags,
+		}
+		if zs.Duration < 1 {
+			zs.Duration = 1
+		}
+		if s.hasParent {
+			zs.ParentID = hex.EncodeToString(s.parentID[:])
+		}
+		if ip := net.ParseIP(s.remoteIP); ip != nil {
+			zs.RemoteEndpoint = &zipkinEndpoint{Port: s.remotePort}
+			if ip.To4() != nil {
+				zs.RemoteEndpoint.IPv4 = ip.String()
+			} else {
+				zs.RemoteEndpoint.IPv6 = ip.String()
+			}
+		}
+		zipkinSpans = append(zipkinSpans, zs)
+	}
+
+	body, _ := json.Marshal(zipkinSpans)
+	return body
+}
@@ -0,0 +1,152 @@
+package accessLog
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSpanExporterZipkin(t *testing.T) {
+	collector := &otlpCollector{}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	exporter := NewSpanExporter(SpanConfig{Format: SpanZipkin, Endpoint: srv.URL, ServiceName: "shop"})
+
+	router := route.NewEngine(config.NewOptions([]config.Option{}))
+	router.Use(LoggerWithConfig(LoggerConfig{Sink: exporter}))
+	router.GET("/users/:id", func(c context.Context, ctx *app.RequestContext) {
+		time.Sleep(2 * time.Millisecond)
+	})
+	router.GET("/fail", func(c context.Context, ctx *app.RequestContext) {
+		ctx.AbortWithStatus(503)
+	})
+
+	_ = ut.PerformRequest(router, "GET", "/users/1?a=b", nil,
+		ut.Header{Key: "traceparent", Value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"})
+	_ = ut.PerformRequest(router, "GET", "/users/2", nil,
+		ut.Header{Key: "traceparent", Value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"})
+	_ = ut.PerformRequest(router, "GET", "/fail", nil)
+	assert.NoError(t, exporter.Close())
+
+	assert.Len(t, collector.bodies, 1)
+	assert.Equal(t, "application/json", collector.headers[0].Get("Content-Type"))
+
+	var spans []zipkinSpan
+	assert.NoError(t, json.Unmarshal(collector.bodies[0], &spans))
+	// the unsampled request is not exported
+	assert.Len(t, spans, 2)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].ParentID)
+	assert.Len(t, spans[0].ID, 16)
+	assert.Equal(t, "GET /users/:id", spans[0].Name)
+	assert.Equal(t, "SERVER", spans[0].Kind)
+	assert.Equal(t, "shop", spans[0].LocalEndpoint.ServiceName)
+	assert.GreaterOrEqual(t, spans[0].Duration, int64(2000))
+	assert.Equal(t, map[string]string{
+		"http.method":      "GET",
+		"http.path":        "/users/1",
+		"http.route":       "/users/:id",
+		"http.status_code": "200",
+	}, spans[0].Tags)
+
+	assert.Len(t, spans[1].TraceID, 32)
+	assert.NotEqual(t, spans[0].TraceID, spans[1].TraceID)
+	assert.Empty(t, spans[1].ParentID)
+	assert.Equal(t, "503", spans[1].Tags["error"])
+}
+
+func TestSpanExporterOTLP(t *testing.T) {
+	collector := &otlpCollector{}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	end := time.Unix(100, 0)
+	param := LogFormatterParams{
+		TimeStamp:  end,
+		Latency:    time.Second,
+		Method:     "POST",
+		Path:       "/orders",
+		Route:      "/orders",
+		StatusCode: 500,
+	}
+
+	exporter := NewSpanExporter(SpanConfig{Endpoint: srv.URL, Encoding: OTLPJSON})
+	exporter.Emit(context.Background(), param)
+	exporter.Emit(context.Background(), LogFormatterParams{InFlight: true})
+	hijacked := param
+	hijacked.Hijacked = true
+	exporter.Emit(context.Background(), hijacked)
+	assert.NoError(t, exporter.Close())
+
+	var payload struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []otlpJSONKeyValue
+			}
+			ScopeSpans []struct {
+				Spans []otlpJSONSpan
+			}
+		}
+	}
+	assert.NoError(t, json.Unmarshal(collector.bodies[0], &payload))
+	assert.Equal(t, "unknown_service", *payload.ResourceSpans[0].Resource.Attributes[0].Value.StringValue)
+	spans := payload.ResourceSpans[0].ScopeSpans[0].Spans
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "POST /orders", spans[0].Name)
+	assert.Equal(t, 2, spans[0].Kind)
+	assert.Equal(t, "99000000000", spans[0].StartTimeUnixNano)
+	assert.Equal(t, "100000000000", spans[0].EndTimeUnixNano)
+	assert.Equal(t, 2, spans[0].Status.Code)
+
+	collector = &otlpCollector{}
+	srv2 := httptest.NewServer(collector)
+	defer srv2.Close()
+
+	exporter = NewSpanExporter(SpanConfig{Endpoint: srv2.URL, ServiceName: "shop"})
+	exporter.Emit(context.Background(), param)
+	assert.NoError(t, exporter.Close())
+
+	assert.Equal(t, "application/x-protobuf", collector.headers[0].Get("Content-Type"))
+	req := protoFields(t, collector.bodies[0])
+	resourceSpans := protoFields(t, req[1][0].data)
+	resource := protoFields(t, resourceSpans[1][0].data)
+	kv := protoFields(t, resource[1][0].data)
+	assert.Equal(t, "shop", string(protoFields(t, kv[2][0].data)[1][0].data))
+
+	s := protoFields(t, protoFields(t, resourceSpans[2][0].data)[2][0].data)
+	assert.Len(t, s[1][0].data, 16)
+	assert.Len(t, s[2][0].data, 8)
+	assert.Empty(t, s[4])
+	assert.Equal(t, "POST /orders", string(s[5][0].data))
+	assert.Equal(t, uint64(2), s[6][0].n)
+	assert.Equal(t, uint64(99e9), s[7][0].n)
+	assert.Equal(t, uint64(100e9), s[8][0].n)
+	assert.Equal(t, uint64(2), protoFields(t, s[15][0].data)[3][0].n)
+	assert.NotEqual(t, hex.EncodeToString(make([]byte, 16)), hex.EncodeToString(s[1][0].data))
+}
+
+func TestSpanIDsAreStable(t *testing.T) {
+	param := LogFormatterParams{TimeStamp: time.Unix(100, 5), Latency: time.Second, Method: "GET", Path: "/a", RemoteIP: "10.0.0.1", RemotePort: 4000}
+
+	// a redelivered event is exported as the same span
+	first, _ := newSpan(&param)
+	again, _ := newSpan(&param)
+	assert.Equal(t, first.traceID, again.traceID)
+	assert.Equal(t, first.spanID, again.spanID)
+
+	other := param
+	other.RemotePort = 4001
+	s, _ := newSpan(&other)
+	assert.NotEqual(t, first.spanID, s.spanID)
+	assert.NotEqual(t, first.traceID, s.traceID)
+}
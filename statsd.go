@@ -0,0 +1,295 @@
+package accessLog
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatsDConfig defines the config for StatsD.
+type StatsDConfig struct {
+	// Network is the network of the agent, udp or unixgram.
+	// Optional. Default value is "udp".
+	Network string
+
+	// Addr is the address of the agent, a socket path for unixgram.
+	// Optional. Default value is "127.0.0.1:8125".
+	Addr string
+
+	// Prefix is prepended to the metric names requests, latency and bytes.
+	// Optional. Default value is "http".
+	Prefix string
+
+	// Tags are added to every metric, such as env:prod.
+	// Optional. Default value is nil.
+	Tags []string
+
+	// FlushInterval is the interval the aggregated metrics are sent at.
+	// Optional. Default value is 1 second.
+	FlushInterval time.Duration
+
+	// MaxPacketSize is the maximum size of a datagram. Metrics are batched
+	// into packets up to this size.
+	// Optional. Default value is 1432, fitting an Ethernet MTU.
+	MaxPacketSize int
+
+	// MaxTimerSamples is the maximum number of latencies kept per route, method
+	// and status class between flushes. Beyond it latencies are sampled, and
+	// sent with their sample rate so the agent still counts every request.
+	// Optional. Default value is 100.
+	MaxTimerSamples int
+
+	// ErrorHandler is called with the errors sending packets.
+	// Optional. Default value is nil, errors are dropped.
+	ErrorHandler func(err error)
+}
+
+// StatsD is a Sink reporting access events to a StatsD agent as the
+// DogStatsD metrics <prefix>.requests, a counter, <prefix>.latency, a timer
+// in milliseconds, and <prefix>.bytes, a counter of response bytes, tagged
+// with route, method and status class. Counters are aggregated between
+// flushes, timer values are sampled down to MaxTimerSamples per flush.
+type StatsD struct {
+	conf StatsDConfig
+	conn net.Conn
+
+	mu       sync.Mutex
+	closed   bool
+	counters map[statsDKey]*statsDCounters
+	timers   map[statsDKey]*statsDTimer
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+type statsDKey struct {
+	route  string
+	method string
+	status string
+}
+
+type statsDCounters struct {
+	requests int64
+	bytes    int64
+}
+
+// statsDTimer is a reservoir sample of the latencies of a key.
+type statsDTimer struct {
+	count   int64
+	samples []float64
+}
+
+// add records ms, keeping at most max samples of all the values added.
+func (t *statsDTimer) add(ms float64, max int) {
+	t.count++
+	if len(t.samples) < max {
+		t.samples = append(t.samples, ms)
+		return
+	}
+	if i := rand.Int63n(t.count); i < int64(max) {
+		t.samples[i] = ms
+	}
+}
+
+// rate returns the sample rate section of the samples, empty when all are kept.
+func (t *statsDTimer) rate() string {
+	if int64(len(t.samples)) == t.count {
+		return ""
+	}
+	return "|@" + strconv.FormatFloat(float64(len(t.samples))/float64(t.count), 'g', 6, 64)
+}
+
+// NewStatsD instance a StatsD with config, connected to the agent.
+func NewStatsD(conf StatsDConfig) (*StatsD, error) {
+	if conf.Network == "" {
+		conf.Network = "udp"
+	}
+	if conf.Addr == "" {
+		conf.Addr = "127.0.0.1:8125"
+	}
+	if conf.Prefix == "" {
+		conf.Prefix = "http"
+	}
+	if conf.FlushInterval <= 0 {
+		conf.FlushInterval = time.Second
+	}
+	if conf.MaxPacketSize <= 0 {
+		conf.MaxPacketSize = 1432
+	}
+	if conf.MaxTimerSamples <= 0 {
+		conf.MaxTimerSamples = 100
+	}
+
+	conn, err := net.Dial(conf.Network, conf.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &StatsD{
+		conf:     conf,
+		conn:     conn,
+		counters: make(map[statsDKey]*statsDCounters),
+		timers:   make(map[statsDKey]*statsDTimer),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Emit implements Sink. Events of requests still running, the final events of
+// hijacked connections and the events emitted after Close are not counted.
+func (s *StatsD) Emit(_ context.Context, param LogFormatterParams) {
+	if param.InFlight || param.Hijacked {
+		return
+	}
+
+	k := statsDKey{
+		route:  param.Route,
+		method: param.Method,
+		status: strconv.Itoa(param.StatusCode/100) + "xx",
+	}
+	ms := float64(param.Latency) / float64(time.Millisecond)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+
+	c, ok := s.counters[k]
+	if !ok {
+		c = &statsDCounters{}
+		s.counters[k] = c
+	}
+	c.requests++
+	c.bytes += int64(param.BodySize)
+	tm, ok := s.timers[k]
+	if !ok {
+		tm = &statsDTimer{}
+		s.timers[k] = tm
+	}
+	tm.add(ms, s.conf.MaxTimerSamples)
+}
+
+// Flush sends the metrics aggregated since the last flush.
+func (s *StatsD) Flush() {
+	s.mu.Lock()
+	counters, timers := s.counters, s.timers
+	s.counters = make(map[statsDKey]*statsDCounters, len(counters))
+	s.timers = make(map[statsDKey]*statsDTimer, len(timers))
+	s.mu.Unlock()
+
+	keys := make([]statsDKey, 0, len(counters))
+	for k := range counters {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+
+	p := statsDPacker{max: s.conf.MaxPacketSize, send: s.send}
+	for _, k := range keys {
+		tags := s.tags(k)
+		c := counters[k]
+		p.add(s.conf.Prefix + ".requests:" + strconv.FormatInt(c.requests, 10) + "|c" + tags)
+		p.add(s.conf.Prefix + ".bytes:" + strconv.FormatInt(c.bytes, 10) + "|c" + tags)
+		if tm := timers[k]; tm != nil {
+			rate := tm.rate()
+			for _, ms := range tm.samples {
+				p.add(s.conf.Prefix + ".latency:" + strconv.FormatFloat(ms, 'f', -1, 64) + "|ms" + rate + tags)
+			}
+		}
+	}
+	p.flush()
+}
+
+// Close flushes the pending metrics and closes the connection to the agent.
+// The events emitted afterwards are dropped.
+func (s *StatsD) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	s.once.Do(func() {
+		close(s.stop)
+		<-s.done
+	})
+	s.Flush()
+	return s.conn.Close()
+}
+
+func (s *StatsD) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.conf.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *StatsD) send(packet []byte) {
+	if _, err := s.conn.Write(packet); err != nil && s.conf.ErrorHandler != nil {
+		s.conf.ErrorHandler(err)
+	}
+}
+
+// tags returns the DogStatsD tag section of k.
+func (s *StatsD) tags(k statsDKey) string {
+	tags := make([]string, 0, len(s.conf.Tags)+3)
+	tags = append(tags, s.conf.Tags...)
+	if k.route != "" {
+		tags = append(tags, "route:"+statsDTagValue(k.route))
+	}
+	tags = append(tags, "method:"+statsDTagValue(k.method), "status:"+k.status)
+	return "|#" + strings.Join(tags, ",")
+}
+
+// statsDTagValue replaces the characters delimiting the DogStatsD fields.
+func statsDTagValue(v string) string {
+	return strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_").Replace(v)
+}
+
+// statsDPacker batches newline separated metric lines into packets of at most max bytes.
+type statsDPacker struct {
+	max  int
+	buf  []byte
+	send func(packet []byte)
+}
+
+func (p *statsDPacker) add(line string) {
+	if len(p.buf) > 0 && len(p.buf)+1+len(line) > p.max {
+		p.flush()
+	}
+	if len(p.buf) > 0 {
+		p.buf = append(p.buf, '\n')
+	}
+	p.buf = append(p.buf, line...)
+}
+
+func (p *statsDPacker) flush() {
+	if len(p.buf) == 0 {
+		return
+	}
+	p.send(p.buf)
+	p.buf = nil
+}
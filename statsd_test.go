@@ -0,0 +1,133 @@
+package accessLog
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readPackets reads the datagrams received by pc until it stays idle.
+func readPackets(t *testing.T, pc net.PacketConn) []string {
+	var packets []string
+	buf := make([]byte, 65536)
+	for {
+		_ = pc.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			return packets
+		}
+		packets = append(packets, string(buf[:n]))
+	}
+}
+
+func TestStatsD(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer pc.Close()
+
+	s, err := NewStatsD(StatsDConfig{Addr: pc.LocalAddr().String(), Tags: []string{"env:test"}, FlushInterval: time.Hour})
+	assert.NoError(t, err)
+
+	s.Emit(context.Background(), LogFormatterParams{Method: "GET", Route: "/users/:id", StatusCode: 200, Latency: 1500 * time.Microsecond, BodySize: 10})
+	s.Emit(context.Background(), LogFormatterParams{Method: "GET", Route: "/users/:id", StatusCode: 204, Latency: 2 * time.Millisecond, BodySize: 5})
+	s.Emit(context.Background(), LogFormatterParams{Method: "POST", Route: "", StatusCode: 404, Latency: time.Millisecond})
+	s.Emit(context.Background(), LogFormatterParams{Method: "GET", Route: "/users/:id", StatusCode: 200, InFlight: true})
+	assert.NoError(t, s.Close())
+
+	packets := readPackets(t, pc)
+	assert.Len(t, packets, 1)
+	assert.Equal(t, strings.Join([]string{
+		"http.requests:1|c|#env:test,method:POST,status:4xx",
+		"http.bytes:0|c|#env:test,method:POST,status:4xx",
+		"http.latency:1|ms|#env:test,method:POST,status:4xx",
+		"http.requests:2|c|#env:test,route:/users/:id,method:GET,status:2xx",
+		"http.bytes:15|c|#env:test,route:/users/:id,method:GET,status:2xx",
+		"http.latency:1.5|ms|#env:test,route:/users/:id,method:GET,status:2xx",
+		"http.latency:2|ms|#env:test,route:/users/:id,method:GET,status:2xx",
+	}, "\n"), packets[0])
+}
+
+func TestStatsDBatching(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer pc.Close()
+
+	s, err := NewStatsD(StatsDConfig{Addr: pc.LocalAddr().String(), MaxPacketSize: 200, FlushInterval: 10 * time.Millisecond})
+	assert.NoError(t, err)
+	defer s.Close()
+
+	for i := 0; i < 50; i++ {
+		s.Emit(context.Background(), LogFormatterParams{Method: "GET", Route: "/a", StatusCode: 200, Latency: time.Millisecond})
+	}
+
+	packets := readPackets(t, pc)
+	assert.Greater(t, len(packets), 1)
+	var latencies int
+	for _, p := range packets {
+		assert.LessOrEqual(t, len(p), 200)
+		latencies += strings.Count(p, "http.latency:1|ms")
+	}
+	assert.Equal(t, 50, latencies)
+}
+
+func TestStatsDUnixgram(t *testing.T) {
+	dir, err := os.MkdirTemp("", "statsd")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	addr := filepath.Join(dir, "dsd.sock")
+
+	pc, err := net.ListenPacket("unixgram", addr)
+	assert.NoError(t, err)
+	defer pc.Close()
+
+	s, err := NewStatsD(StatsDConfig{Network: "unixgram", Addr: addr, Prefix: "web", FlushInterval: time.Hour})
+	assert.NoError(t, err)
+	s.Emit(context.Background(), LogFormatterParams{Method: "GET", Route: "/a", StatusCode: 500})
+	assert.NoError(t, s.Close())
+
+	packets := readPackets(t, pc)
+	if assert.Len(t, packets, 1) {
+		assert.True(t, strings.HasPrefix(packets[0], "web.requests:1|c|#route:/a,method:GET,status:5xx\n"))
+	}
+}
+
+func TestStatsDTimerSampling(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer pc.Close()
+
+	s, err := NewStatsD(StatsDConfig{Addr: pc.LocalAddr().String(), MaxTimerSamples: 10, FlushInterval: time.Hour})
+	assert.NoError(t, err)
+
+	for i := 0; i < 50; i++ {
+		s.Emit(context.Background(), LogFormatterParams{Method: "GET", Route: "/a", StatusCode: 200, Latency: time.Millisecond})
+	}
+	assert.NoError(t, s.Close())
+
+	packets := readPackets(t, pc)
+	assert.Len(t, packets, 1)
+	assert.Equal(t, 10, strings.Count(packets[0], "http.latency:1|ms|@0.2|#route:/a,method:GET,status:2xx"))
+	assert.Contains(t, packets[0], "http.requests:50|c")
+}
+
+func TestStatsDEmitAfterClose(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer pc.Close()
+
+	s, err := NewStatsD(StatsDConfig{Addr: pc.LocalAddr().String(), FlushInterval: time.Hour})
+	assert.NoError(t, err)
+	assert.NoError(t, s.Close())
+
+	s.Emit(context.Background(), LogFormatterParams{Method: "GET", Route: "/a", StatusCode: 200})
+	s.mu.Lock()
+	assert.Empty(t, s.counters)
+	assert.Empty(t, s.timers)
+	s.mu.Unlock()
+	assert.Empty(t, readPackets(t, pc))
+}
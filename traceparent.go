@@ -0,0 +1,57 @@
+package accessLog
+
+import (
+	"encoding/hex"
+	"github.com/cloudwego/hertz/pkg/protocol"
+	"strings"
+)
+
+// traceParent is the W3C trace context of a request.
+type traceParent struct {
+	traceID [16]byte
+	spanID  [8]byte
+	flags   byte
+}
+
+// requestTraceParent returns the trace context of the traceparent header of
+// req, false when it has none or it is invalid.
+func requestTraceParent(req *protocol.Request) (traceParent, bool) {
+	if req == nil {
+		return traceParent{}, false
+	}
+	return parseTraceParent(string(req.Header.Peek("traceparent")))
+}
+
+// parseTraceParent parses a traceparent header value, such as
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01.
+func parseTraceParent(v string) (traceParent, bool) {
+	var tp traceParent
+
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return tp, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return tp, false
+	}
+
+	var version, flags [1]byte
+	if _, err := hex.Decode(version[:], []byte(parts[0])); err != nil {
+		return tp, false
+	}
+	if _, err := hex.Decode(tp.traceID[:], []byte(parts[1])); err != nil {
+		return tp, false
+	}
+	if _, err := hex.Decode(tp.spanID[:], []byte(parts[2])); err != nil {
+		return tp, false
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return tp, false
+	}
+	if tp.traceID == [16]byte{} || tp.spanID == [8]byte{} {
+		return tp, false
+	}
+	tp.flags = flags[0]
+	return tp, true
+}
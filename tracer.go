@@ -0,0 +1,195 @@
+package accessLog
+
+import (
+	"context"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/tracer/stats"
+	"github.com/cloudwego/hertz/pkg/common/tracer/traceinfo"
+	"sync"
+	"time"
+)
+
+// Tracer is a Hertz tracer holding back the access events of the Logger
+// middleware until the response has been written, so every event carries the
+// latency of each server phase. The events of a hijacked connection are
+// released once its upgrade response has been written, without waiting for
+// the connection to close.
+//
+// Register it with server.WithTracer and server.WithTraceLevel(stats.LevelDetailed),
+// then pass it to LoggerConfig.Tracer.
+type Tracer struct {
+	sink Sink
+	skip map[string]struct{}
+}
+
+// NewTracer instance a Tracer that only completes the access events of the Logger middleware.
+func NewTracer() *Tracer {
+	return &Tracer{}
+}
+
+// TracerWithConfig instance a Tracer that also logs, with config, every request
+// the Logger middleware never saw, such as requests Hertz rejected before
+// routing because of a malformed header, a body too large or a read timeout.
+// Only the Formatter, Output, ErrorHandler, Outputs, Sink and SkipPaths of
+// config are used.
+func TracerWithConfig(conf LoggerConfig) *Tracer {
+	return &Tracer{
+		sink: newSink(conf),
+		skip: newSkipSet(conf.SkipPaths),
+	}
+}
+
+// tracedRequest holds the access events of a request until Tracer.Finish.
+type tracedRequest struct {
+	mu       sync.Mutex
+	observed bool
+	finished bool
+	pending  []pendingEvent
+}
+
+type pendingEvent struct {
+	sink  Sink
+	param LogFormatterParams
+}
+
+// Start implements tracer.Tracer.
+func (t *Tracer) Start(c context.Context, _ *app.RequestContext) context.Context {
+	return context.WithValue(c, t, &tracedRequest{})
+}
+
+// Finish implements tracer.Tracer. It adds the phase latencies recorded by
+// Hertz to the held access events and emits them, or logs the request itself
+// when the Logger middleware never saw it.
+func (t *Tracer) Finish(c context.Context, ctx *app.RequestContext) {
+	observed, released := t.release(c, ctx)
+	if released && !observed && t.sink != nil {
+		t.logUnobserved(c, ctx)
+	}
+}
+
+// release emits the access events held for the request started as c, the
+// first time it is called for it; the events emitted afterwards are not held.
+// It returns whether this call released the request, and if so whether the
+// Logger middleware saw it.
+func (t *Tracer) release(c context.Context, ctx *app.RequestContext) (observed, released bool) {
+	tr, ok := c.Value(t).(*tracedRequest)
+	if !ok {
+		return false, false
+	}
+
+	// Hertz finishes a keep-alive connection's last context again when it
+	// times out waiting for the next request.
+	tr.mu.Lock()
+	if tr.finished {
+		tr.mu.Unlock()
+		return false, false
+	}
+	tr.finished = true
+	observed, pending := tr.observed, tr.pending
+	tr.pending = nil
+	tr.mu.Unlock()
+
+	for _, e := range pending {
+		setPhaseLatencies(&e.param, ctx.GetTraceInfo())
+		e.sink.Emit(c, e.param)
+	}
+	return observed, true
+}
+
+// logUnobserved emits the access event of a request the Logger middleware never saw.
+func (t *Tracer) logUnobserved(c context.Context, ctx *app.RequestContext) {
+	path := string(ctx.Request.URI().PathOriginal())
+	if _, ok := t.skip[path]; ok {
+		return
+	}
+
+	param := LogFormatterParams{
+		Request: ctx.Copy().GetRequest(),
+		Keys:    ctx.Keys,
+	}
+
+	param.TimeStamp = time.Now()
+	if ti := ctx.GetTraceInfo(); ti != nil && ti.Stats() != nil {
+		if e := ti.Stats().GetEvent(stats.HTTPStart); e != nil && !e.IsNil() {
+			param.Latency = param.TimeStamp.Sub(e.Time())
+		}
+		param.ServerError = ti.Stats().Error()
+	}
+
+	param.ClientIP = ctx.ClientIP()
+	param.Method = string(ctx.Request.Header.Method())
+	param.StatusCode = ctx.Response.StatusCode()
+	param.Host = string(ctx.Request.Host())
+	if param.ServerError != nil {
+		param.ErrorMessage = param.ServerError.Error()
+	}
+
+	setConnParams(&param, ctx)
+	setPhaseLatencies(&param, ctx.GetTraceInfo())
+
+	if raw := string(ctx.Request.URI().QueryString()); raw != "" {
+		path = path + "?" + raw
+	}
+	param.Path = path
+
+	param.BodySize = len(ctx.Response.Body())
+	param.ContentLength = param.BodySize
+
+	t.sink.Emit(c, param)
+}
+
+// observe records that the Logger middleware saw the request started as c.
+func (t *Tracer) observe(c context.Context) {
+	if tr, ok := c.Value(t).(*tracedRequest); ok {
+		tr.mu.Lock()
+		tr.observed = true
+		tr.mu.Unlock()
+	}
+}
+
+// emit holds param until Finish when c was started by t, or emits it right
+// away otherwise.
+func (t *Tracer) emit(c context.Context, sink Sink, param LogFormatterParams) {
+	tr, ok := c.Value(t).(*tracedRequest)
+	if !ok {
+		sink.Emit(c, param)
+		return
+	}
+
+	tr.mu.Lock()
+	if !tr.finished {
+		tr.pending = append(tr.pending, pendingEvent{sink: sink, param: param})
+		tr.mu.Unlock()
+		return
+	}
+	tr.mu.Unlock()
+
+	sink.Emit(c, param)
+}
+
+// setPhaseLatencies fills the phase latencies of param from the trace info.
+func setPhaseLatencies(param *LogFormatterParams, ti traceinfo.TraceInfo) {
+	if ti == nil || ti.Stats() == nil {
+		return
+	}
+	st := ti.Stats()
+
+	param.ReadHeaderLatency = eventsInterval(st, stats.ReadHeaderStart, stats.ReadHeaderFinish)
+	param.ReadBodyLatency = eventsInterval(st, stats.ReadBodyStart, stats.ReadBodyFinish)
+	param.HandleLatency = eventsInterval(st, stats.ServerHandleStart, stats.ServerHandleFinish)
+	param.WriteLatency = eventsInterval(st, stats.WriteStart, stats.WriteFinish)
+
+	param.ServerLatency = eventsInterval(st, stats.HTTPStart, stats.HTTPFinish)
+	if param.ServerLatency == 0 {
+		param.ServerLatency = eventsInterval(st, stats.HTTPStart, stats.WriteFinish)
+	}
+}
+
+// eventsInterval returns the time between two recorded events, 0 if either is missing.
+func eventsInterval(st traceinfo.HTTPStats, start, end stats.Event) time.Duration {
+	s, e := st.GetEvent(start), st.GetEvent(end)
+	if s == nil || e == nil || s.IsNil() || e.IsNil() {
+		return 0
+	}
+	return e.Time().Sub(s.Time())
+}
@@ -0,0 +1,202 @@
+package accessLog
+
+import (
+	"context"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/app/server"
+	"github.com/cloudwego/hertz/pkg/common/tracer/stats"
+	"github.com/cloudwego/hertz/pkg/network"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// noKeepAliveClient closes every connection, so servers shut down promptly.
+var noKeepAliveClient = &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+// freeAddr returns a local address nothing listens on.
+func freeAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// spinServer starts h, waits until it accepts connections and shuts it down
+// at the end of the test.
+func spinServer(t *testing.T, h *server.Hertz, addr string) {
+	go h.Spin()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = h.Shutdown(ctx)
+	})
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("server at %s did not start", addr)
+}
+
+func TestLoggerWithTracer(t *testing.T) {
+	var mu sync.Mutex
+	var params []LogFormatterParams
+	tr := NewTracer()
+
+	addr := freeAddr(t)
+	h := server.New(server.WithHostPorts(addr), server.WithTracer(tr), server.WithTraceLevel(stats.LevelDetailed))
+	h.Use(LoggerWithConfig(LoggerConfig{
+		Tracer: tr,
+		Sink: SinkFunc(func(c context.Context, param LogFormatterParams) {
+			mu.Lock()
+			params = append(params, param)
+			mu.Unlock()
+		}),
+	}))
+	h.GET("/example", func(c context.Context, ctx *app.RequestContext) {
+		time.Sleep(5 * time.Millisecond)
+		ctx.String(http.StatusOK, "ok")
+	})
+	spinServer(t, h, addr)
+
+	resp, err := noKeepAliveClient.Get("http://" + addr + "/example")
+	assert.NoError(t, err)
+	_, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(params) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	p := params[0]
+	assert.Equal(t, 200, p.StatusCode)
+	assert.GreaterOrEqual(t, p.HandleLatency, 5*time.Millisecond)
+	assert.Greater(t, p.ReadHeaderLatency, time.Duration(0))
+	assert.Greater(t, p.WriteLatency, time.Duration(0))
+	assert.GreaterOrEqual(t, p.ServerLatency, p.HandleLatency+p.WriteLatency)
+}
+
+func TestTracerEmitWithoutStart(t *testing.T) {
+	var got []LogFormatterParams
+	sink := SinkFunc(func(c context.Context, param LogFormatterParams) {
+		got = append(got, param)
+	})
+
+	NewTracer().emit(context.Background(), sink, LogFormatterParams{StatusCode: 200})
+	assert.Len(t, got, 1)
+}
+
+func TestTracerWithConfig(t *testing.T) {
+	var mu sync.Mutex
+	var params []LogFormatterParams
+	sink := SinkFunc(func(c context.Context, param LogFormatterParams) {
+		mu.Lock()
+		params = append(params, param)
+		mu.Unlock()
+	})
+	collected := func(n int) []LogFormatterParams {
+		assert.Eventually(t, func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(params) >= n
+		}, time.Second, 10*time.Millisecond)
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		got := params
+		params = nil
+		return got
+	}
+
+	tr := TracerWithConfig(LoggerConfig{Sink: sink})
+	addr := freeAddr(t)
+	h := server.New(server.WithHostPorts(addr), server.WithTracer(tr))
+	h.Use(LoggerWithConfig(LoggerConfig{Sink: sink, Tracer: tr}))
+	h.GET("/example", func(c context.Context, ctx *app.RequestContext) {})
+	spinServer(t, h, addr)
+
+	// routed requests are logged once, by the middleware
+	resp, err := noKeepAliveClient.Get("http://" + addr + "/example")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	got := collected(1)
+	assert.Len(t, got, 1)
+	assert.Equal(t, 200, got[0].StatusCode)
+	assert.Nil(t, got[0].ServerError)
+
+	// malformed requests never reach the router
+	conn, err := net.Dial("tcp", addr)
+	assert.NoError(t, err)
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+	_, _ = conn.Write([]byte("NOT-AN-HTTP-REQUEST-LINE-AT-ALL-REALLY\r\n\r\n"))
+	_, _ = io.ReadAll(conn)
+	conn.Close()
+	got = collected(1)
+	assert.Len(t, got, 1)
+	assert.Equal(t, 400, got[0].StatusCode)
+	assert.Error(t, got[0].ServerError)
+	assert.Equal(t, got[0].ServerError.Error(), got[0].ErrorMessage)
+}
+
+func TestLoggerWithTracerHijackedConn(t *testing.T) {
+	var mu sync.Mutex
+	var params []LogFormatterParams
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(params)
+	}
+	tr := NewTracer()
+
+	closeConn := make(chan struct{})
+	addr := freeAddr(t)
+	h := server.New(server.WithHostPorts(addr), server.WithTracer(tr), server.WithTraceLevel(stats.LevelDetailed))
+	h.Use(LoggerWithConfig(LoggerConfig{
+		Tracer: tr,
+		Sink: SinkFunc(func(c context.Context, param LogFormatterParams) {
+			mu.Lock()
+			params = append(params, param)
+			mu.Unlock()
+		}),
+	}))
+	h.GET("/ws", func(c context.Context, ctx *app.RequestContext) {
+		ctx.SetStatusCode(http.StatusSwitchingProtocols)
+		ctx.Response.Header.Set("Connection", "Upgrade")
+		ctx.Response.Header.Set("Upgrade", "test")
+		ctx.Hijack(func(conn network.Conn) {
+			<-closeConn
+		})
+	})
+	spinServer(t, h, addr)
+
+	conn, err := net.Dial("tcp", addr)
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n"))
+	assert.NoError(t, err)
+
+	// the upgrade is logged while the connection is still open
+	assert.Eventually(t, func() bool { return count() == 1 }, time.Second, 10*time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, http.StatusSwitchingProtocols, params[0].StatusCode)
+	assert.False(t, params[0].Hijacked)
+	assert.Greater(t, params[0].HandleLatency, time.Duration(0))
+	mu.Unlock()
+
+	close(closeConn)
+	assert.Eventually(t, func() bool { return count() == 2 }, time.Second, 10*time.Millisecond)
+	mu.Lock()
+	assert.True(t, params[1].Hijacked)
+	mu.Unlock()
+}
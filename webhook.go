@@ -0,0 +1,405 @@
+package accessLog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebhookFormat is the body format of a webhook batch.
+type WebhookFormat string
+
+const (
+	// WebhookJSON posts a batch as a JSON array.
+	WebhookJSON WebhookFormat = "json"
+	// WebhookNDJSON posts a batch as newline delimited JSON.
+	WebhookNDJSON WebhookFormat = "ndjson"
+)
+
+// WebhookConfig defines the config for Webhook.
+type WebhookConfig struct {
+	// URL is the endpoint the batches are posted to.
+	URL string
+
+	// Format is the body format.
+	// Optional. Default value is WebhookJSON.
+	Format WebhookFormat
+
+	// Gzip compresses the bodies.
+	// Optional. Default value is false.
+	Gzip bool
+
+	// Headers are added to every request, such as an Authorization.
+	// Optional. Default value is nil.
+	Headers map[string]string
+
+	// SpoolDir is a directory the batches are spooled to while the endpoint
+	// is unavailable, to be replayed in order once it is back.
+	// Optional. Default value is "", failed batches are dropped.
+	SpoolDir string
+
+	// MaxSpoolBytes caps the size of the spool directory. Past it, the oldest
+	// spooled batches are evicted.
+	// Optional. Default value is 1 GiB.
+	MaxSpoolBytes int64
+
+	// ReplayInterval is the interval spooled batches are replayed at.
+	// Optional. Default value is 30 seconds.
+	ReplayInterval time.Duration
+
+	// Timeout is the timeout of a request.
+	// Optional. Default value is 10 seconds.
+	Timeout time.Duration
+
+	// Batch defines how events are batched, by count, bytes and time, and
+	// how failed batches, answered 429 or 5xx, are retried.
+	Batch BatchConfig
+
+	// ErrorHandler is called with the errors of the batches dropped, spooled
+	// or evicted from the spool.
+	// Optional. Default value is nil, errors are dropped.
+	ErrorHandler func(err error)
+}
+
+// Webhook is a Sink posting batches of access events, as their JSON
+// representation, to an HTTP endpoint.
+type Webhook struct {
+	conf    WebhookConfig
+	client  *http.Client
+	header  http.Header
+	batcher *batcher[[]byte]
+
+	// mu serializes sending and spooling, keeping batches in order.
+	mu         sync.Mutex
+	spool      []spooledBatch
+	spoolBytes int64
+	seq        uint64
+	stop       chan struct{}
+	done       chan struct{}
+	closed     sync.Once
+}
+
+// spooledBatch is a batch waiting in the spool directory.
+type spooledBatch struct {
+	name string
+	size int64
+}
+
+// NewWebhook instance a Webhook with config. It fails when the URL is not an
+// absolute http or https URL, or when the spool directory cannot be created
+// or read; batches spooled by a previous process are replayed.
+func NewWebhook(conf WebhookConfig) (*Webhook, error) {
+	u, err := url.Parse(conf.URL)
+	if err != nil {
+		return nil, fmt.Errorf("webhook: invalid URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("webhook: invalid URL %q", conf.URL)
+	}
+	if conf.Format == "" {
+		conf.Format = WebhookJSON
+	}
+	if conf.ReplayInterval <= 0 {
+		conf.ReplayInterval = 30 * time.Second
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 10 * time.Second
+	}
+	if conf.MaxSpoolBytes <= 0 {
+		conf.MaxSpoolBytes = 1 << 30
+	}
+	conf.Batch = conf.Batch.withDefaults()
+
+	header := make(http.Header, len(conf.Headers)+2)
+	for k, v := range conf.Headers {
+		header.Set(k, v)
+	}
+
+	w := &Webhook{
+		conf:   conf,
+		client: &http.Client{Timeout: conf.Timeout},
+		header: header,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if conf.SpoolDir != "" {
+		if err := w.openSpool(); err != nil {
+			return nil, err
+		}
+	}
+	w.batcher = newSizedBatcher(conf.Batch, func(item []byte) int { return len(item) + 1 }, w.flush)
+	go w.replayLoop()
+	return w, nil
+}
+
+// Emit implements Sink. It queues the event without blocking, dropping it
+// when the queue is full.
+func (w *Webhook) Emit(_ context.Context, param LogFormatterParams) {
+	b, err := json.Marshal(newJSONEvent(&param))
+	if err != nil {
+		if w.conf.ErrorHandler != nil {
+			w.conf.ErrorHandler(err)
+		}
+		return
+	}
+	w.batcher.add(b)
+}
+
+// EmitBatch implements BatchSink, posting params as one batch. Failed batches
+// are returned rather than spooled.
+func (w *Webhook) EmitBatch(c context.Context, params []LogFormatterParams) error {
+	items := make([][]byte, 0, len(params))
+	for i := range params {
+		b, err := json.Marshal(newJSONEvent(&params[i]))
+		if err != nil {
+			return err
+		}
+		items = append(items, b)
+	}
+	body, err := w.encode(items)
+	if err != nil {
+		return err
+	}
+	return w.conf.Batch.retry(c, func() error {
+		return w.post(body, w.spoolExt())
+	})
+}
+
+// Dropped returns the number of events dropped because the queue was full.
+func (w *Webhook) Dropped() uint64 {
+	return w.batcher.dropped()
+}
+
+// Spooled returns the number of batches waiting in the spool directory.
+func (w *Webhook) Spooled() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.spool)
+}
+
+// Close sends the queued events, spooling them if the endpoint is
+// unavailable, and stops the replay of the spool.
+func (w *Webhook) Close() error {
+	w.closed.Do(func() {
+		close(w.stop)
+		<-w.done
+	})
+	w.batcher.close()
+	return nil
+}
+
+// spoolExt is the extension of the spooled batches. The suffix records the
+// encoding, so that a batch is replayed as it was encoded.
+func (w *Webhook) spoolExt() string {
+	ext := "." + string(w.conf.Format)
+	if w.conf.Gzip {
+		ext += ".gz"
+	}
+	return ext
+}
+
+// openSpool creates the spool directory and lists the batches left in it.
+func (w *Webhook) openSpool() error {
+	if err := os.MkdirAll(w.conf.SpoolDir, 0o755); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(w.conf.SpoolDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(name, ".tmp") {
+			// a batch whose spooling was interrupted
+			_ = os.Remove(filepath.Join(w.conf.SpoolDir, name))
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.SplitN(name, ".", 2)[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		w.spool = append(w.spool, spooledBatch{name: name, size: info.Size()})
+		w.spoolBytes += info.Size()
+		if seq > w.seq {
+			w.seq = seq
+		}
+	}
+	sort.Slice(w.spool, func(i, j int) bool { return w.spool[i].name < w.spool[j].name })
+	w.evictSpool()
+	return nil
+}
+
+// encode returns the body of items.
+func (w *Webhook) encode(items [][]byte) ([]byte, error) {
+	var body []byte
+	if w.conf.Format == WebhookNDJSON {
+		body = append(bytes.Join(items, []byte("\n")), '\n')
+	} else {
+		body = append(append([]byte("["), bytes.Join(items, []byte(","))...), ']')
+	}
+	if !w.conf.Gzip {
+		return body, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write(body)
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// flush sends a batch. While batches are spooled, it is spooled behind them
+// to keep the order, and the spool is replayed.
+func (w *Webhook) flush(c context.Context, items [][]byte) {
+	body, err := w.encode(items)
+	if err != nil {
+		w.handleError(err)
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.spool) > 0 {
+		w.spoolBatch(body, len(items))
+		w.replay()
+		return
+	}
+
+	err = w.conf.Batch.retry(c, func() error {
+		return w.post(body, w.spoolExt())
+	})
+	if err == nil {
+		return
+	}
+	var perm *permanentError
+	if w.conf.SpoolDir != "" && !errors.As(err, &perm) {
+		w.handleError(fmt.Errorf("webhook: spooling %d events: %w", len(items), err))
+		w.spoolBatch(body, len(items))
+		return
+	}
+	w.handleError(fmt.Errorf("webhook: dropped %d events: %w", len(items), err))
+}
+
+// post sends body, encoded as told by the extension of name.
+func (w *Webhook) post(body []byte, name string) error {
+	header := w.header.Clone()
+	if strings.Contains(name, ".ndjson") {
+		header.Set("Content-Type", "application/x-ndjson")
+	} else {
+		header.Set("Content-Type", "application/json")
+	}
+	if strings.HasSuffix(name, ".gz") {
+		header.Set("Content-Encoding", "gzip")
+	}
+	return postBatch(w.client, w.conf.URL, header, body, func(code int) bool {
+		return code == http.StatusTooManyRequests || code >= 500
+	})
+}
+
+// spoolBatch writes body to the spool directory, evicting the oldest batches
+// past MaxSpoolBytes. w.mu is held.
+func (w *Webhook) spoolBatch(body []byte, events int) {
+	if w.conf.SpoolDir == "" {
+		w.handleError(fmt.Errorf("webhook: dropped %d events", events))
+		return
+	}
+
+	w.seq++
+	name := fmt.Sprintf("%020d%s", w.seq, w.spoolExt())
+	tmp := filepath.Join(w.conf.SpoolDir, name+".tmp")
+	if err := os.WriteFile(tmp, body, 0o644); err != nil {
+		w.handleError(fmt.Errorf("webhook: dropped %d events: %w", events, err))
+		return
+	}
+	if err := os.Rename(tmp, filepath.Join(w.conf.SpoolDir, name)); err != nil {
+		w.handleError(fmt.Errorf("webhook: dropped %d events: %w", events, err))
+		return
+	}
+	w.spool = append(w.spool, spooledBatch{name: name, size: int64(len(body))})
+	w.spoolBytes += int64(len(body))
+	w.evictSpool()
+}
+
+// evictSpool removes the oldest spooled batches while the spool is over
+// MaxSpoolBytes, keeping the newest one. w.mu is held.
+func (w *Webhook) evictSpool() {
+	for len(w.spool) > 1 && w.spoolBytes > w.conf.MaxSpoolBytes {
+		b := w.spool[0]
+		w.spool = w.spool[1:]
+		w.spoolBytes -= b.size
+		if err := os.Remove(filepath.Join(w.conf.SpoolDir, b.name)); err != nil && !os.IsNotExist(err) {
+			w.handleError(fmt.Errorf("webhook: %w", err))
+		}
+		w.handleError(fmt.Errorf("webhook: evicted spooled batch %s of %d bytes", b.name, b.size))
+	}
+}
+
+// replay sends the spooled batches in order, stopping at the first one the
+// endpoint fails to accept. Batches it rejects for good, and batches that
+// cannot be read, are dropped. w.mu is held.
+func (w *Webhook) replay() {
+	for len(w.spool) > 0 {
+		name := w.spool[0].name
+		path := filepath.Join(w.conf.SpoolDir, name)
+
+		body, err := os.ReadFile(path)
+		if err == nil {
+			err = w.post(body, name)
+			var perm *permanentError
+			if err != nil && !errors.As(err, &perm) {
+				return
+			}
+		}
+		if err != nil {
+			w.handleError(fmt.Errorf("webhook: dropped spooled batch %s: %w", name, err))
+		}
+		_ = os.Remove(path)
+		w.spoolBytes -= w.spool[0].size
+		w.spool = w.spool[1:]
+	}
+}
+
+func (w *Webhook) replayLoop() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.conf.ReplayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.mu.Lock()
+			w.replay()
+			w.mu.Unlock()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+func (w *Webhook) handleError(err error) {
+	if w.conf.ErrorHandler != nil {
+		w.conf.ErrorHandler(err)
+	}
+}
@@ -0,0 +1,199 @@
+package accessLog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookGzipJSON(t *testing.T) {
+	collector := &otlpCollector{}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	w, err := NewWebhook(WebhookConfig{
+		URL:     srv.URL,
+		Gzip:    true,
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+		Batch:   BatchConfig{MaxBytes: 400},
+	})
+	assert.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		w.Emit(context.Background(), LogFormatterParams{StatusCode: 200, Path: "/" + strings.Repeat("a", 100)})
+	}
+	assert.NoError(t, w.Close())
+
+	// each event is about 250 bytes: one per batch
+	assert.Len(t, collector.bodies, 4)
+	assert.Equal(t, "gzip", collector.headers[0].Get("Content-Encoding"))
+	assert.Equal(t, "application/json", collector.headers[0].Get("Content-Type"))
+	assert.Equal(t, "Bearer secret", collector.headers[0].Get("Authorization"))
+
+	r, err := gzip.NewReader(bytes.NewReader(collector.bodies[0]))
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(r)
+	var events []map[string]any
+	assert.NoError(t, json.Unmarshal(body, &events))
+	assert.Len(t, events, 1)
+	assert.Equal(t, float64(200), events[0]["status"])
+}
+
+// flakyEndpoint records the NDJSON paths it accepts, answering 503 while down.
+type flakyEndpoint struct {
+	down  atomic.Bool
+	mu    sync.Mutex
+	paths []string
+}
+
+func (f *flakyEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.down.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+		var e map[string]any
+		_ = json.Unmarshal([]byte(line), &e)
+		f.paths = append(f.paths, e["path"].(string))
+	}
+}
+
+func TestWebhookSpool(t *testing.T) {
+	endpoint := &flakyEndpoint{}
+	endpoint.down.Store(true)
+	srv := httptest.NewServer(endpoint)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	conf := WebhookConfig{
+		URL:            srv.URL,
+		Format:         WebhookNDJSON,
+		SpoolDir:       dir,
+		ReplayInterval: 10 * time.Millisecond,
+		Batch:          BatchConfig{MaxSize: 2, FlushInterval: time.Hour, MaxRetries: -1},
+	}
+
+	// /a and /b fill a batch, /c is flushed alone by Close
+	w, err := NewWebhook(conf)
+	assert.NoError(t, err)
+	w.Emit(context.Background(), LogFormatterParams{Path: "/a"})
+	w.Emit(context.Background(), LogFormatterParams{Path: "/b"})
+	w.Emit(context.Background(), LogFormatterParams{Path: "/c"})
+	assert.NoError(t, w.Close())
+	assert.Equal(t, 2, w.Spooled())
+
+	files, _ := os.ReadDir(dir)
+	assert.Len(t, files, 2)
+
+	// a new process replays the spool in order once the endpoint is back
+	endpoint.down.Store(false)
+	w, err = NewWebhook(conf)
+	assert.NoError(t, err)
+	w.Emit(context.Background(), LogFormatterParams{Path: "/d"})
+	assert.Eventually(t, func() bool { return w.Spooled() == 0 }, time.Second, 10*time.Millisecond)
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, []string{"/a", "/b", "/c", "/d"}, endpoint.paths)
+	files, _ = os.ReadDir(dir)
+	assert.Empty(t, files)
+}
+
+func TestWebhookMaxSpoolBytes(t *testing.T) {
+	endpoint := &flakyEndpoint{}
+	endpoint.down.Store(true)
+	srv := httptest.NewServer(endpoint)
+	defer srv.Close()
+
+	var evicted atomic.Int32
+	dir := t.TempDir()
+	conf := WebhookConfig{
+		URL:            srv.URL,
+		Format:         WebhookNDJSON,
+		SpoolDir:       dir,
+		MaxSpoolBytes:  150,
+		ReplayInterval: 10 * time.Millisecond,
+		Batch:          BatchConfig{MaxSize: 1, MaxRetries: -1},
+		ErrorHandler: func(err error) {
+			if strings.Contains(err.Error(), "evicted") {
+				evicted.Add(1)
+			}
+		},
+	}
+
+	w, err := NewWebhook(conf)
+	assert.NoError(t, err)
+	for _, path := range []string{"/a", "/b", "/c"} {
+		w.Emit(context.Background(), LogFormatterParams{Path: path})
+	}
+	assert.NoError(t, w.Close())
+
+	// each batch is about 100 bytes: only the newest one is kept
+	assert.Equal(t, 1, w.Spooled())
+	assert.Equal(t, int32(2), evicted.Load())
+	files, _ := os.ReadDir(dir)
+	assert.Len(t, files, 1)
+
+	endpoint.down.Store(false)
+	w, err = NewWebhook(conf)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool { return w.Spooled() == 0 }, time.Second, 10*time.Millisecond)
+	assert.NoError(t, w.Close())
+	assert.Equal(t, []string{"/c"}, endpoint.paths)
+}
+
+func TestWebhookInvalidURL(t *testing.T) {
+	for _, u := range []string{"", "example.com/ingest", "ftp://example.com", "http://", "http://%zz"} {
+		_, err := NewWebhook(WebhookConfig{URL: u})
+		assert.Error(t, err, u)
+	}
+}
+
+func TestWebhookUnreadableSpool(t *testing.T) {
+	endpoint := &flakyEndpoint{}
+	srv := httptest.NewServer(endpoint)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	first := filepath.Join(dir, "00000000000000000001.ndjson")
+	assert.NoError(t, os.WriteFile(first, []byte(`{"path":"/a"}`+"\n"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "00000000000000000002.ndjson"), []byte(`{"path":"/b"}`+"\n"), 0o644))
+
+	var dropped atomic.Int32
+	w, err := NewWebhook(WebhookConfig{
+		URL:            srv.URL,
+		Format:         WebhookNDJSON,
+		SpoolDir:       dir,
+		ReplayInterval: time.Hour,
+		Batch:          BatchConfig{MaxSize: 1},
+		ErrorHandler: func(err error) {
+			if strings.Contains(err.Error(), "dropped spooled batch") {
+				dropped.Add(1)
+			}
+		},
+	})
+	assert.NoError(t, err)
+
+	// the first spooled batch can no longer be read: it does not hold back the others
+	assert.NoError(t, os.Remove(first))
+	assert.NoError(t, os.Mkdir(first, 0o755))
+	w.Emit(context.Background(), LogFormatterParams{Path: "/c"})
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, 0, w.Spooled())
+	assert.Equal(t, int32(1), dropped.Load())
+	assert.Equal(t, []string{"/b", "/c"}, endpoint.paths)
+}